@@ -1,10 +1,12 @@
 module github.com/ggsood/terraform-provider-kibana/v7
 
-go 1.14
+go 1.15
 
 require (
 	github.com/ggsood/go-kibana-rest/v7 v7.9.2
-	github.com/hashicorp/terraform-plugin-sdk v1.16.0
+	github.com/go-resty/resty/v2 v2.1.0
+	github.com/hashicorp/go-cty v1.4.1-0.20200414143053-d3edf31b6320
+	github.com/hashicorp/terraform-plugin-sdk/v2 v2.7.0
 	github.com/onsi/ginkgo v1.14.1 // indirect
 	github.com/onsi/gomega v1.10.2 // indirect
 	github.com/pkg/errors v0.9.1
@@ -0,0 +1,86 @@
+package kb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/pkg/errors"
+)
+
+// kibanaCapability is the range of Kibana version supported by resource
+// MinVersion is the first version that support it and RemovedVersion the first version that not support it anymore
+// When Attribute is set, the range is only checked when the attribute is used
+type kibanaCapability struct {
+	Attribute      string
+	MinVersion     *kibanaVersion
+	RemovedVersion *kibanaVersion
+	Hint           string
+}
+
+// kibanaCapabilities is the capability matrix of each resource
+// The provider already need Kibana 7.0.0 or newer, so only newer requirements are declared here
+var kibanaCapabilities = map[string][]kibanaCapability{
+	"kibana_copy_object": {
+		{MinVersion: mustParseKibanaVersion("7.3.0")},
+		{Attribute: "create_new_copies", MinVersion: mustParseKibanaVersion("7.10.0")},
+	},
+	"kibana_object_spaces": {
+		{MinVersion: mustParseKibanaVersion("8.0.0")},
+	},
+	"kibana_logstash_pipeline": {
+		{
+			RemovedVersion: mustParseKibanaVersion("8.0.0"),
+			Hint:           "Logstash central management is not handled by Kibana anymore, use Elasticsearch Logstash API instead",
+		},
+	},
+}
+
+// checkKibanaCapabilities permit to check at plan time that Kibana support the resource and the attributes used
+func checkKibanaCapabilities(resourceName string) schema.CustomizeDiffFunc {
+	return func(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+		if len(kibanaCapabilities[resourceName]) == 0 {
+			return nil
+		}
+
+		conf := meta.(*ProviderConf)
+		if _, err := getClient(ctx, conf); err != nil {
+			return err
+		}
+
+		return checkCapabilities(kibanaCapabilities[resourceName], resourceName, conf.version, func(attribute string) bool {
+			_, ok := d.GetOk(attribute)
+			return ok
+		})
+	}
+}
+
+// checkCapabilities permit to check that Kibana version match with each capability
+// isUsed permit to know if attribute is used on resource
+func checkCapabilities(capabilities []kibanaCapability, resourceName string, version *kibanaVersion, isUsed func(attribute string) bool) error {
+	for _, capability := range capabilities {
+		if capability.Attribute != "" && !isUsed(capability.Attribute) {
+			continue
+		}
+
+		name := resourceName
+		action := "You need to upgrade Kibana to use this resource"
+		if capability.Attribute != "" {
+			name = fmt.Sprintf("%s.%s", resourceName, capability.Attribute)
+			action = fmt.Sprintf("You need to upgrade Kibana or remove %s", capability.Attribute)
+		}
+
+		if capability.MinVersion != nil && version.LessThan(capability.MinVersion) {
+			return errors.Errorf("%s need Kibana %s or newer, but Kibana is %s. %s", name, capability.MinVersion, version, action)
+		}
+		if capability.RemovedVersion != nil && !version.LessThan(capability.RemovedVersion) {
+			message := fmt.Sprintf("%s is not supported since Kibana %s, but Kibana is %s", name, capability.RemovedVersion, version)
+			if capability.Hint != "" {
+				message = fmt.Sprintf("%s. %s", message, capability.Hint)
+			}
+			return errors.New(message)
+		}
+	}
+
+	return nil
+}
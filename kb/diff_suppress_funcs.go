@@ -3,9 +3,8 @@ package kb
 import (
 	"encoding/json"
 	"reflect"
-	"strings"
 
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 )
 
 // suppressEquivalentJSON permit to compare json string
@@ -20,59 +19,57 @@ func suppressEquivalentJSON(k, old, new string, d *schema.ResourceData) bool {
 	return reflect.DeepEqual(oldObj, newObj)
 }
 
-// suppressEquivalentNDJSON permit to compare ndjson string
+// suppressImportedName permit to keep the name of imported resource
+// The name is not known when resource is imported, and the resource ID is the import ID
+func suppressImportedName(k, old, new string, d *schema.ResourceData) bool {
+	return old == "" && d.Id() != ""
+}
+
+// suppressEquivalentNDJSON permit to compare ndjson string of saved objects
+// Objects are compared by type and id, once normalized without the ignored fields
+// Old value can be the hash of objects, when only hash is stored on state
+// New value is the hash computed by the state function, so the data from configuration is used when it's available
 func suppressEquivalentNDJSON(k, old, new string, d *schema.ResourceData) bool {
+	fields := defaultIgnoredFields
+	var managedObjects []interface{}
+	if d != nil {
+		fields = ignoredFields(d)
+		managedObjects = d.Get("objects").(*schema.Set).List()
+		if _, isHash := parseSavedObjectsHash(new); isHash {
+			if data, ok := d.Get(k).(string); ok && data != "" {
+				new = data
+			}
+		}
+	}
 
-	// NDJSON mean sthat each line correspond to JSON struct
-	oldSlice := strings.Split(old, "\n")
-	newSlice := strings.Split(new, "\n")
-	oldObjSlice := make([]map[string]interface{}, len(oldSlice))
-	newObjSlice := make([]map[string]interface{}, len(newSlice))
-	if len(oldSlice) != len(newSlice) {
+	changes, err := savedObjectsChanges(old, new, fields, managedObjects)
+	if err != nil {
 		return false
 	}
 
-	// Convert string line to JSON
-	for i, oldJSON := range oldSlice {
-		jsonObj := make(map[string]interface{})
-		if err := json.Unmarshal([]byte(oldJSON), &jsonObj); err != nil {
-			return false
-		}
-
-		delete(jsonObj, "version")
-		delete(jsonObj, "updated_at")
+	return len(changes) == 0
+}
 
-		oldObjSlice[i] = jsonObj
+// savedObjectsChanges return the readable list of saved objects changed between old and new ndjson string
+// Objects only in old value, like exported references, are ignored if they are not in managed objects
+// All objects are managed when managed objects are unknown
+func savedObjectsChanges(old string, new string, ignoredFields []string, managedObjects []interface{}) ([]string, error) {
+	oldHashes, err := hashSavedObjects(old, ignoredFields)
+	if err != nil {
+		return nil, err
 	}
-	for i, newJSON := range newSlice {
-		jsonObj := make(map[string]interface{})
-		if err := json.Unmarshal([]byte(newJSON), &jsonObj); err != nil {
-			return false
-		}
-		delete(jsonObj, "version")
-		delete(jsonObj, "updated_at")
-
-		newObjSlice[i] = jsonObj
+	newHashes, err := hashSavedObjects(new, ignoredFields)
+	if err != nil {
+		return nil, err
 	}
 
-	// Compare json obj
-	for _, oldJSON := range oldObjSlice {
-		isFound := false
-		for _, newJSON := range newObjSlice {
-			if oldJSON["id"].(string) == newJSON["id"].(string) {
-				if reflect.DeepEqual(oldJSON, newJSON) == false {
-					return false
-				}
-				isFound = true
-				break
-			}
-		}
-
-		if isFound == false {
-			return false
-		}
+	managedKeys := map[string]bool{}
+	for _, object := range buildExportObjects(managedObjects) {
+		managedKeys[savedObjectKey(object["type"], object["id"])] = true
+	}
+	isManaged := func(key string) bool {
+		return managedObjects == nil || managedKeys[key]
 	}
 
-	return true
-
+	return diffSavedObjects(oldHashes, newHashes, isManaged), nil
 }
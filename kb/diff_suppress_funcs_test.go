@@ -0,0 +1,130 @@
+package kb
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestSuppressEquivalentNDJSON(t *testing.T) {
+	r := resourceKibanaObject()
+
+	config := `{"id":"test","type":"index-pattern","attributes":{"title":"test"},"references":[]}
+{"id":"test","type":"dashboard","attributes":{"title":"test"},"references":[{"name":"panel_0","type":"visualization","id":"a"},{"name":"panel_1","type":"visualization","id":"b"}]}`
+
+	testCases := []struct {
+		name     string
+		old      string
+		new      string
+		raw      map[string]interface{}
+		expected bool
+	}{
+		{
+			name: "volatile fields, order of objects and references, and summary line are ignored",
+			old: `{"id":"test","type":"dashboard","attributes":{"title":"test"},"references":[{"name":"panel_1","type":"visualization","id":"b"},{"name":"panel_0","type":"visualization","id":"a"}],"version":"WzEsMV0=","updated_at":"2021-01-01T00:00:00.000Z","migrationVersion":{"dashboard":"7.9.3"},"namespaces":["default"]}
+{"id":"test","type":"index-pattern","attributes":{"title":"test"},"references":[],"version":"WzIsMV0="}
+{"exportedCount":2,"missingRefCount":0,"missingReferences":[]}`,
+			new:      config,
+			expected: true,
+		},
+		{
+			name:     "objects with same id and different type are not mixed",
+			old:      `{"id":"test","type":"index-pattern","attributes":{"title":"test"},"references":[]}`,
+			new:      `{"id":"test","type":"dashboard","attributes":{"title":"test"},"references":[]}`,
+			expected: false,
+		},
+		{
+			name:     "attributes change is detected",
+			old:      `{"id":"test","type":"index-pattern","attributes":{"title":"test"},"references":[]}`,
+			new:      `{"id":"test","type":"index-pattern","attributes":{"title":"updated"},"references":[]}`,
+			expected: false,
+		},
+		{
+			name:     "line without id not panic",
+			old:      `{"type":"index-pattern","attributes":{"title":"test"}}`,
+			new:      `{"id":"test","type":"index-pattern","attributes":{"title":"test"}}`,
+			expected: false,
+		},
+		{
+			name:     "invalid JSON is not equivalent",
+			old:      `{"id":"test",`,
+			new:      `{"id":"test","type":"index-pattern"}`,
+			expected: false,
+		},
+		{
+			name: "exported references not in data are ignored",
+			old: config + `
+{"id":"a","type":"visualization","attributes":{"title":"a"},"references":[]}`,
+			new: config,
+			raw: map[string]interface{}{
+				"objects": []interface{}{
+					map[string]interface{}{"id": "test", "type": "index-pattern"},
+					map[string]interface{}{"id": "test", "type": "dashboard"},
+				},
+			},
+			expected: true,
+		},
+		{
+			name: "objects removed from data are detected",
+			old: config + `
+{"id":"a","type":"visualization","attributes":{"title":"a"},"references":[]}`,
+			new: config,
+			raw: map[string]interface{}{
+				"objects": []interface{}{
+					map[string]interface{}{"id": "test", "type": "index-pattern"},
+					map[string]interface{}{"id": "test", "type": "dashboard"},
+					map[string]interface{}{"id": "a", "type": "visualization"},
+				},
+			},
+			expected: false,
+		},
+		{
+			name: "ignored fields can be configured with nested fields",
+			old:  `{"id":"test","type":"index-pattern","attributes":{"title":"test","fields":"[]"},"references":[],"version":"WzEsMV0="}`,
+			new:  `{"id":"test","type":"index-pattern","attributes":{"title":"test"},"references":[],"version":"WzIsMV0="}`,
+			raw: map[string]interface{}{
+				"ignored_fields": []interface{}{"version", "attributes.fields"},
+			},
+			expected: true,
+		},
+		{
+			name: "default ignored fields are replaced by configured fields",
+			old:  `{"id":"test","type":"index-pattern","attributes":{"title":"test"},"references":[],"version":"WzEsMV0="}`,
+			new:  `{"id":"test","type":"index-pattern","attributes":{"title":"test"},"references":[],"version":"WzIsMV0="}`,
+			raw: map[string]interface{}{
+				"ignored_fields": []interface{}{"updated_at"},
+			},
+			expected: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		raw := map[string]interface{}{
+			"name": "test",
+			"data": testCase.new,
+		}
+		for key, value := range testCase.raw {
+			raw[key] = value
+		}
+		d := schema.TestResourceDataRaw(t, r.Schema, raw)
+
+		if result := suppressEquivalentNDJSON("data", testCase.old, testCase.new, d); result != testCase.expected {
+			t.Errorf("%s: expected %t, got %t", testCase.name, testCase.expected, result)
+		}
+	}
+}
+
+func TestSuppressEquivalentNDJSONLargeExport(t *testing.T) {
+	oldLines := make([]string, 0, 20000)
+	newLines := make([]string, 0, 20000)
+	for i := 0; i < 20000; i++ {
+		oldLines = append(oldLines, fmt.Sprintf(`{"id":"%d","type":"visualization","attributes":{"title":"%d"},"version":"WzEsMV0="}`, i, i))
+		newLines = append(newLines, fmt.Sprintf(`{"id":"%d","type":"visualization","attributes":{"title":"%d"}}`, 19999-i, 19999-i))
+	}
+
+	if !suppressEquivalentNDJSON("data", strings.Join(oldLines, "\n"), strings.Join(newLines, "\n"), nil) {
+		t.Fatal("Large exports with same objects must be equivalent")
+	}
+}
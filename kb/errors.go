@@ -0,0 +1,156 @@
+package kb
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/ggsood/go-kibana-rest/v7/kbapi"
+	"github.com/go-resty/resty/v2"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/pkg/errors"
+)
+
+// maxErrorBodyLength is the maximum length of response body kept on error when Kibana not return JSON error
+const maxErrorBodyLength = 1024
+
+// kibanaError is the error returned when Kibana API call failed
+// It keep the status code and the message provided by Kibana
+type kibanaError struct {
+	StatusCode int
+	Method     string
+	Path       string
+	Message    string
+}
+
+// Error return readable error message
+func (e *kibanaError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s %s failed with status %d %s", e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("%s %s failed with status %d %s: %s", e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// newKibanaError permit to build kibanaError from API response
+func newKibanaError(resp *resty.Response) *kibanaError {
+	kbError := &kibanaError{
+		StatusCode: resp.StatusCode(),
+		Method:     resp.Request.Method,
+		Path:       resp.Request.RawRequest.URL.Path,
+	}
+
+	// Kibana error body look like {"statusCode": 400, "error": "Bad Request", "message": "..."}
+	body := struct {
+		Message string `json:"message"`
+	}{}
+	if err := json.Unmarshal(resp.Body(), &body); err == nil && body.Message != "" {
+		kbError.Message = body.Message
+	} else if len(resp.Body()) > maxErrorBodyLength {
+		kbError.Message = string(resp.Body()[:maxErrorBodyLength]) + "..."
+	} else {
+		kbError.Message = string(resp.Body())
+	}
+
+	return kbError
+}
+
+// checkResponseError is resty middleware that return kibanaError when Kibana API call failed
+// Not found is not handled here, because the Kibana client already manage it for each API
+func checkResponseError(c *resty.Client, resp *resty.Response) error {
+	if resp.StatusCode() < http.StatusBadRequest || resp.StatusCode() == http.StatusNotFound {
+		return nil
+	}
+
+	return newKibanaError(resp)
+}
+
+// errorStatusCode return the HTTP status code of error returned by Kibana API
+// It return 0 if error not come from Kibana API
+func errorStatusCode(err error) int {
+	var kbError *kibanaError
+	if errors.As(err, &kbError) {
+		return kbError.StatusCode
+	}
+
+	var apiError kbapi.APIError
+	if errors.As(err, &apiError) {
+		return apiError.Code
+	}
+
+	var apiErrorPtr *kbapi.APIError
+	if errors.As(err, &apiErrorPtr) && apiErrorPtr != nil {
+		return apiErrorPtr.Code
+	}
+
+	return 0
+}
+
+// isNotFoundError return true if Kibana API return not found
+func isNotFoundError(err error) bool {
+	return errorStatusCode(err) == http.StatusNotFound
+}
+
+// isConflictError return true if Kibana API return conflict
+func isConflictError(err error) bool {
+	return errorStatusCode(err) == http.StatusConflict
+}
+
+// isForbiddenError return true if Kibana API refuse the authentication or the authorization
+func isForbiddenError(err error) bool {
+	code := errorStatusCode(err)
+	return code == http.StatusUnauthorized || code == http.StatusForbidden
+}
+
+// isBadRequestError return true if Kibana API refuse the request payload
+func isBadRequestError(err error) bool {
+	return errorStatusCode(err) == http.StatusBadRequest
+}
+
+// isTransientError return true if the error is temporary and the call can be retried later
+// It's the case when Kibana is unreachable, overloaded or restarting
+func isTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var netError net.Error
+	if errors.As(err, &netError) {
+		return true
+	}
+
+	return isTransientStatusCode(errorStatusCode(err))
+}
+
+// isTransientStatusCode return true if the HTTP status code mean Kibana or a proxy is temporary unavailable
+func isTransientStatusCode(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// diagFromKibanaError return error diagnostic with hint about how to solve it, based on error class
+func diagFromKibanaError(err error) diag.Diagnostics {
+	var detail string
+	switch {
+	case isForbiddenError(err):
+		detail = "Check that the provider credentials are valid and have the privileges needed to manage this resource"
+	case isConflictError(err):
+		detail = "The object already exists or was modified at the same time, you can import it or retry"
+	case isBadRequestError(err):
+		detail = "Kibana refused the request, check the resource attributes"
+	case isTransientError(err):
+		detail = "Kibana is not available for the moment, you can retry later or increase retry and timeouts settings"
+	}
+
+	return diag.Diagnostics{
+		{
+			Severity: diag.Error,
+			Summary:  err.Error(),
+			Detail:   detail,
+		},
+	}
+}
@@ -0,0 +1,78 @@
+package kb
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	kibana "github.com/ggsood/go-kibana-rest/v7"
+	"github.com/ggsood/go-kibana-rest/v7/kbapi"
+	"github.com/pkg/errors"
+)
+
+func TestErrorClassification(t *testing.T) {
+	notFound := kbapi.NewAPIError(404, "404 Not Found")
+	conflict := &kibanaError{StatusCode: 409}
+	forbidden := errors.Wrap(&kibanaError{StatusCode: 403}, "Error when create role")
+	badRequest := &kibanaError{StatusCode: 400}
+	unavailable := &kibanaError{StatusCode: 503}
+	other := errors.New("something wrong")
+
+	if !isNotFoundError(notFound) || isNotFoundError(conflict) || isNotFoundError(other) {
+		t.Error("Only not found error must be classified as not found")
+	}
+	if !isConflictError(conflict) || isConflictError(badRequest) {
+		t.Error("Only conflict error must be classified as conflict")
+	}
+	if !isForbiddenError(forbidden) || isForbiddenError(other) {
+		t.Error("Wrapped forbidden error must be classified as forbidden")
+	}
+	if !isBadRequestError(badRequest) || isBadRequestError(notFound) {
+		t.Error("Only bad request error must be classified as bad request")
+	}
+	if !isTransientError(unavailable) || isTransientError(badRequest) || isTransientError(other) {
+		t.Error("Only unavailable error must be classified as transient")
+	}
+}
+
+func TestCheckResponseError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodPut:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"statusCode": 400, "error": "Bad Request", "message": "[request body.kibana]: unknown feature privilege"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, err := kibana.NewClient(kibana.Config{Address: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = withContext(context.Background(), client)
+
+	_, err = client.API.KibanaRoleManagement.CreateOrUpdate(&kbapi.KibanaRole{Name: "test"})
+	if !isBadRequestError(err) {
+		t.Fatalf("Error must be classified as bad request, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "unknown feature privilege") {
+		t.Errorf("Error must contain Kibana message, got %s", err.Error())
+	}
+
+	// Not found is still handled by the Kibana client
+	role, err := client.API.KibanaRoleManagement.Get("test")
+	if err != nil || role != nil {
+		t.Errorf("Role must be not found without error, got %v", err)
+	}
+
+	err = client.API.KibanaRoleManagement.Delete("test")
+	if !isNotFoundError(err) {
+		t.Errorf("Error must be classified as not found, got %v", err)
+	}
+}
@@ -0,0 +1,924 @@
+package kb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ggsood/go-kibana-rest/v7/kbapi"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+var (
+	fakeSpacePrefixRegexp = regexp.MustCompile(`^/s/([^/]+)(/.*)$`)
+	fakeSavedObjectRegexp = regexp.MustCompile(`^/api/saved_objects/([^/_][^/]*)/([^/]+)$`)
+)
+
+// fakeFeatures is the Kibana features with their sub feature privileges
+var fakeFeatures = []interface{}{
+	map[string]interface{}{
+		"id": "dashboard",
+		"subFeatures": []interface{}{
+			map[string]interface{}{
+				"name": "Short URLs",
+				"privilegeGroups": []interface{}{
+					map[string]interface{}{
+						"groupType":  "independent",
+						"privileges": []interface{}{map[string]interface{}{"id": "url_create"}},
+					},
+				},
+			},
+		},
+	},
+	map[string]interface{}{
+		"id":          "discover",
+		"subFeatures": []interface{}{},
+	},
+}
+
+// fakeKibana is in memory Kibana API, used to test resources lifecycle without real Kibana
+// It implement status, spaces, features, roles, saved objects and logstash pipelines API
+type fakeKibana struct {
+	*httptest.Server
+
+	mutex     sync.Mutex
+	version   string
+	spaces    map[string]*kbapi.KibanaSpace
+	roles     map[string]map[string]interface{}
+	objects   map[string]map[string]map[string]interface{}
+	pipelines map[string]*kbapi.LogstashPipeline
+	failures  []*fakeFailure
+	requests  []string
+	copies    int
+}
+
+// fakeFailure is an error that fake Kibana return on the next matching request
+// When response is set, it's returned instead of the error message
+type fakeFailure struct {
+	method     string
+	path       string
+	statusCode int
+	message    string
+	response   interface{}
+}
+
+// testKibanaVersions is the list of Kibana versions used to run lifecycle tests, one by major version
+var testKibanaVersions = []string{"7.10.2", "8.11.1"}
+
+// newFakeKibana start fake Kibana with the default space
+// It's stopped at the end of the test
+func newFakeKibana(t *testing.T, version string) *fakeKibana {
+	fake := &fakeKibana{
+		version: version,
+		spaces: map[string]*kbapi.KibanaSpace{
+			"default": {ID: "default", Name: "Default", Reserved: true},
+		},
+		roles:     map[string]map[string]interface{}{},
+		objects:   map[string]map[string]map[string]interface{}{"default": {}},
+		pipelines: map[string]*kbapi.LogstashPipeline{},
+	}
+	fake.Server = httptest.NewServer(http.HandlerFunc(fake.handle))
+	t.Cleanup(fake.Close)
+
+	return fake
+}
+
+// conf return provider configuration to use the fake Kibana
+func (f *fakeKibana) conf() *ProviderConf {
+	return &ProviderConf{
+		rawUrl: f.URL,
+	}
+}
+
+// failNext permit to return error on the next request that match method and path prefix
+func (f *fakeKibana) failNext(method string, path string, statusCode int, message string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.failures = append(f.failures, &fakeFailure{
+		method:     method,
+		path:       path,
+		statusCode: statusCode,
+		message:    message,
+	})
+}
+
+// respondNext permit to return response on the next request that match method and path prefix
+func (f *fakeKibana) respondNext(method string, path string, statusCode int, response interface{}) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.failures = append(f.failures, &fakeFailure{
+		method:     method,
+		path:       path,
+		statusCode: statusCode,
+		response:   response,
+	})
+}
+
+// addObject permit to add saved object directly in space
+func (f *fakeKibana) addObject(space string, object map[string]interface{}) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.spaceObjects(space)[fakeObjectKey(object["type"].(string), object["id"].(string))] = object
+}
+
+// getObject return saved object from space or nil if not exist
+func (f *fakeKibana) getObject(space string, objectType string, id string) map[string]interface{} {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.spaceObjects(space)[fakeObjectKey(objectType, id)]
+}
+
+// deleteObject permit to delete saved object directly in space
+func (f *fakeKibana) deleteObject(space string, objectType string, id string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	delete(f.spaceObjects(space), fakeObjectKey(objectType, id))
+}
+
+func (f *fakeKibana) spaceObjects(space string) map[string]map[string]interface{} {
+	if f.objects[space] == nil {
+		f.objects[space] = map[string]map[string]interface{}{}
+	}
+	return f.objects[space]
+}
+
+func fakeObjectKey(objectType string, id string) string {
+	return objectType + "/" + id
+}
+
+// isVersion8 return true if fake Kibana return the payloads of Kibana 8
+func (f *fakeKibana) isVersion8() bool {
+	return !mustParseKibanaVersion(f.version).LessThan(mustParseKibanaVersion("8.0.0"))
+}
+
+// setVersion8Fields set the fields that Kibana 8 add on saved objects
+func (f *fakeKibana) setVersion8Fields(object map[string]interface{}) {
+	if !f.isVersion8() {
+		return
+	}
+	object["coreMigrationVersion"] = "8.8.0"
+	object["typeMigrationVersion"] = "8.0.0"
+	object["managed"] = false
+}
+
+func (f *fakeKibana) handle(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.requests = append(f.requests, fmt.Sprintf("%s %s", r.Method, r.URL.Path))
+
+	for i, failure := range f.failures {
+		if failure.method == r.Method && strings.HasPrefix(r.URL.Path, failure.path) {
+			f.failures = append(f.failures[:i], f.failures[i+1:]...)
+			if failure.response != nil {
+				fakeJSON(w, failure.statusCode, failure.response)
+				return
+			}
+			fakeError(w, failure.statusCode, failure.message)
+			return
+		}
+	}
+
+	space := "default"
+	path := r.URL.Path
+	if matches := fakeSpacePrefixRegexp.FindStringSubmatch(path); matches != nil {
+		space = matches[1]
+		path = matches[2]
+		if f.spaces[space] == nil {
+			fakeError(w, http.StatusNotFound, fmt.Sprintf("Space %s not found", space))
+			return
+		}
+	}
+
+	switch {
+	case path == "/api/status":
+		fakeJSON(w, http.StatusOK, map[string]interface{}{
+			"version": map[string]interface{}{"number": f.version},
+		})
+	case strings.HasPrefix(path, "/api/spaces/space"):
+		f.handleSpaces(w, r, strings.TrimPrefix(strings.TrimPrefix(path, "/api/spaces/space"), "/"))
+	case path == "/api/spaces/_copy_saved_objects":
+		f.handleCopySavedObjects(w, r, space)
+	case path == "/api/spaces/_resolve_copy_saved_objects_errors":
+		f.handleResolveCopySavedObjectsErrors(w, r, space)
+	case path == "/api/spaces/_update_objects_spaces":
+		f.handleUpdateObjectsSpaces(w, r, space)
+	case path == "/api/spaces/_get_shareable_references":
+		f.handleGetShareableReferences(w, r, space)
+	case path == "/api/features":
+		fakeJSON(w, http.StatusOK, fakeFeatures)
+	case strings.HasPrefix(path, "/api/security/role/"):
+		f.handleRoles(w, r, strings.TrimPrefix(path, "/api/security/role/"))
+	case path == "/api/saved_objects/_import":
+		f.handleImport(w, r, space)
+	case path == "/api/saved_objects/_resolve_import_errors":
+		f.handleResolveImportErrors(w, r, space)
+	case path == "/api/saved_objects/_export":
+		f.handleExport(w, r, space)
+	case fakeSavedObjectRegexp.MatchString(path):
+		matches := fakeSavedObjectRegexp.FindStringSubmatch(path)
+		f.handleSavedObject(w, r, space, matches[1], matches[2])
+	case strings.HasPrefix(path, "/api/logstash/pipeline/"):
+		f.handleLogstashPipelines(w, r, strings.TrimPrefix(path, "/api/logstash/pipeline/"))
+	default:
+		fakeError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+func (f *fakeKibana) handleSpaces(w http.ResponseWriter, r *http.Request, id string) {
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		spaces := make([]*kbapi.KibanaSpace, 0, len(f.spaces))
+		for _, space := range f.spaces {
+			spaces = append(spaces, space)
+		}
+		fakeJSON(w, http.StatusOK, spaces)
+	case r.Method == http.MethodPost && id == "":
+		space := &kbapi.KibanaSpace{}
+		if err := json.NewDecoder(r.Body).Decode(space); err != nil {
+			fakeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if f.spaces[space.ID] != nil {
+			fakeError(w, http.StatusConflict, fmt.Sprintf("A space with the identifier %s already exists.", space.ID))
+			return
+		}
+		f.spaces[space.ID] = space
+		fakeJSON(w, http.StatusOK, space)
+	case f.spaces[id] == nil:
+		fakeError(w, http.StatusNotFound, "Not Found")
+	case r.Method == http.MethodGet:
+		fakeJSON(w, http.StatusOK, f.spaces[id])
+	case r.Method == http.MethodPut:
+		space := &kbapi.KibanaSpace{}
+		if err := json.NewDecoder(r.Body).Decode(space); err != nil {
+			fakeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		f.spaces[id] = space
+		fakeJSON(w, http.StatusOK, space)
+	case r.Method == http.MethodDelete:
+		delete(f.spaces, id)
+		delete(f.objects, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		fakeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+func (f *fakeKibana) handleRoles(w http.ResponseWriter, r *http.Request, name string) {
+	switch r.Method {
+	case http.MethodGet:
+		if f.roles[name] == nil {
+			fakeError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		role := f.roles[name]
+		if f.isVersion8() {
+			role = map[string]interface{}{"transient_metadata": map[string]interface{}{"enabled": true}}
+			for key, value := range f.roles[name] {
+				role[key] = value
+			}
+		}
+		fakeJSON(w, http.StatusOK, role)
+	case http.MethodPut:
+		role := map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&role); err != nil {
+			fakeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		role["name"] = name
+		f.roles[name] = role
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		if f.roles[name] == nil {
+			fakeError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		delete(f.roles, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		fakeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+func (f *fakeKibana) handleLogstashPipelines(w http.ResponseWriter, r *http.Request, id string) {
+	switch r.Method {
+	case http.MethodGet:
+		if f.pipelines[id] == nil {
+			fakeError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		fakeJSON(w, http.StatusOK, f.pipelines[id])
+	case http.MethodPut:
+		pipeline := &kbapi.LogstashPipeline{}
+		if err := json.NewDecoder(r.Body).Decode(pipeline); err != nil {
+			fakeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		pipeline.ID = id
+		pipeline.Username = "elastic"
+		f.pipelines[id] = pipeline
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		if f.pipelines[id] == nil {
+			fakeError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		delete(f.pipelines, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		fakeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+func (f *fakeKibana) handleSavedObject(w http.ResponseWriter, r *http.Request, space string, objectType string, id string) {
+	key := fakeObjectKey(objectType, id)
+	object := f.spaceObjects(space)[key]
+	if object == nil {
+		fakeError(w, http.StatusNotFound, fmt.Sprintf("Saved object [%s/%s] not found", objectType, id))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		fakeJSON(w, http.StatusOK, object)
+	case http.MethodDelete:
+		delete(f.spaceObjects(space), key)
+		fakeJSON(w, http.StatusOK, map[string]interface{}{})
+	default:
+		fakeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+func (f *fakeKibana) handleImport(w http.ResponseWriter, r *http.Request, space string) {
+	objects, err := fakeReadImportFile(r)
+	if err != nil {
+		fakeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	overwrite := r.URL.Query().Get("overwrite") == "true"
+
+	successCount := 0
+	errors := make([]map[string]interface{}, 0)
+	for _, object := range objects {
+		if importError := f.importObject(space, object, objects, overwrite); importError != nil {
+			errors = append(errors, importError)
+			continue
+		}
+		successCount++
+	}
+
+	fakeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":      len(errors) == 0,
+		"successCount": successCount,
+		"errors":       errors,
+	})
+}
+
+func (f *fakeKibana) handleResolveImportErrors(w http.ResponseWriter, r *http.Request, space string) {
+	objects, err := fakeReadImportFile(r)
+	if err != nil {
+		fakeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	retries := make([]savedObjectImportRetry, 0)
+	if err := json.Unmarshal([]byte(r.FormValue("retries")), &retries); err != nil {
+		fakeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	successCount := 0
+	errors := make([]map[string]interface{}, 0)
+	for _, retry := range retries {
+		object := objects[fakeObjectKey(retry.Type, retry.ID)]
+		if object == nil {
+			continue
+		}
+
+		references, _ := object["references"].([]interface{})
+		for _, rawReference := range references {
+			reference := rawReference.(map[string]interface{})
+			for _, replaceReference := range retry.ReplaceReferences {
+				if reference["type"] == replaceReference.Type && reference["id"] == replaceReference.From {
+					reference["id"] = replaceReference.To
+				}
+			}
+		}
+
+		if importError := f.importObject(space, object, objects, retry.Overwrite); importError != nil {
+			errors = append(errors, importError)
+			continue
+		}
+		successCount++
+	}
+
+	fakeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":      len(errors) == 0,
+		"successCount": successCount,
+		"errors":       errors,
+	})
+}
+
+// importObject permit to store imported object in space, or return the import error like Kibana
+func (f *fakeKibana) importObject(space string, object map[string]interface{}, batch map[string]map[string]interface{}, overwrite bool) map[string]interface{} {
+	objectType := object["type"].(string)
+	id := object["id"].(string)
+	key := fakeObjectKey(objectType, id)
+	attributes, _ := object["attributes"].(map[string]interface{})
+	title := attributes["title"]
+
+	// Like Kibana, only references to index pattern and search are validated
+	missingReferences := make([]interface{}, 0)
+	references, _ := object["references"].([]interface{})
+	for _, rawReference := range references {
+		reference := rawReference.(map[string]interface{})
+		if reference["type"] != "index-pattern" && reference["type"] != "search" {
+			continue
+		}
+		referenceKey := fakeObjectKey(reference["type"].(string), reference["id"].(string))
+		if batch[referenceKey] == nil && f.spaceObjects(space)[referenceKey] == nil {
+			missingReferences = append(missingReferences, map[string]interface{}{
+				"type": reference["type"],
+				"id":   reference["id"],
+			})
+		}
+	}
+	if len(missingReferences) > 0 {
+		return map[string]interface{}{
+			"id":    id,
+			"type":  objectType,
+			"title": title,
+			"error": map[string]interface{}{"type": "missing_references", "references": missingReferences},
+		}
+	}
+
+	if f.spaceObjects(space)[key] != nil && !overwrite {
+		return map[string]interface{}{
+			"id":    id,
+			"type":  objectType,
+			"title": title,
+			"error": map[string]interface{}{"type": "conflict"},
+		}
+	}
+
+	object["updated_at"] = time.Now().UTC().Format(time.RFC3339)
+	object["version"] = fmt.Sprintf("WzEsMV0=%d", len(f.requests))
+	f.setVersion8Fields(object)
+	f.spaceObjects(space)[key] = object
+
+	return nil
+}
+
+// fakeReadImportFile return the saved objects of the NDJSON file sent to import API
+func fakeReadImportFile(r *http.Request) (map[string]map[string]interface{}, error) {
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := map[string]map[string]interface{}{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		object := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &object); err != nil {
+			return nil, err
+		}
+		objectType, _ := object["type"].(string)
+		id, _ := object["id"].(string)
+		if objectType == "" || id == "" {
+			// Export summary line
+			continue
+		}
+		objects[fakeObjectKey(objectType, id)] = object
+	}
+
+	return objects, nil
+}
+
+func (f *fakeKibana) handleExport(w http.ResponseWriter, r *http.Request, space string) {
+	request := struct {
+		Types                 []string            `json:"type"`
+		Objects               []map[string]string `json:"objects"`
+		IncludeReferencesDeep bool                `json:"includeReferencesDeep"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		fakeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(request.Types) == 0 && len(request.Objects) == 0 {
+		fakeError(w, http.StatusBadRequest, "Either `type` or `objects` are required.")
+		return
+	}
+
+	exported := map[string]map[string]interface{}{}
+	for _, objectType := range request.Types {
+		for key, object := range f.spaceObjects(space) {
+			if object["type"] == objectType {
+				exported[key] = object
+			}
+		}
+	}
+	for _, requested := range request.Objects {
+		key := fakeObjectKey(requested["type"], requested["id"])
+		if f.spaceObjects(space)[key] == nil {
+			fakeError(w, http.StatusBadRequest, fmt.Sprintf("Error fetching objects to export: %s not found", key))
+			return
+		}
+		exported[key] = f.spaceObjects(space)[key]
+	}
+	if request.IncludeReferencesDeep {
+		f.addReferences(space, exported)
+	}
+
+	keys := make([]string, 0, len(exported))
+	for key := range exported {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buffer bytes.Buffer
+	for _, key := range keys {
+		line, _ := json.Marshal(exported[key])
+		buffer.Write(line)
+		buffer.WriteString("\n")
+	}
+	summary, _ := json.Marshal(map[string]interface{}{
+		"exportedCount":     len(keys),
+		"missingRefCount":   0,
+		"missingReferences": []interface{}{},
+	})
+	buffer.Write(summary)
+
+	w.Header().Set("Content-Type", "application/ndjson")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buffer.Bytes())
+}
+
+func (f *fakeKibana) handleCopySavedObjects(w http.ResponseWriter, r *http.Request, sourceSpace string) {
+	request := &savedObjectCopyParameter{}
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		fakeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	objects := f.copiedObjects(sourceSpace, request.Objects, request.IncludeReferences)
+
+	response := map[string]interface{}{}
+	for _, targetSpace := range request.Spaces {
+		overwrite := map[string]bool{}
+		for key := range objects {
+			overwrite[key] = request.Overwrite
+		}
+		response[targetSpace] = f.copyObjects(targetSpace, objects, overwrite, request.CreateNewCopies)
+	}
+
+	fakeJSON(w, http.StatusOK, response)
+}
+
+func (f *fakeKibana) handleResolveCopySavedObjectsErrors(w http.ResponseWriter, r *http.Request, sourceSpace string) {
+	request := &struct {
+		Objects           []kbapi.KibanaSpaceObjectParameter `json:"objects"`
+		IncludeReferences bool                               `json:"includeReferences"`
+		CreateNewCopies   bool                               `json:"createNewCopies"`
+		Retries           map[string][]savedObjectCopyRetry  `json:"retries"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		fakeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	objects := f.copiedObjects(sourceSpace, request.Objects, request.IncludeReferences)
+
+	response := map[string]interface{}{}
+	for targetSpace, retries := range request.Retries {
+		retriedObjects := map[string]map[string]interface{}{}
+		overwrite := map[string]bool{}
+		for _, retry := range retries {
+			key := fakeObjectKey(retry.Type, retry.ID)
+			if objects[key] != nil {
+				retriedObjects[key] = objects[key]
+				overwrite[key] = retry.Overwrite
+			}
+		}
+		response[targetSpace] = f.copyObjects(targetSpace, retriedObjects, overwrite, request.CreateNewCopies)
+	}
+
+	fakeJSON(w, http.StatusOK, response)
+}
+
+// copiedObjects return the objects to copy from source space
+func (f *fakeKibana) copiedObjects(sourceSpace string, requestedObjects []kbapi.KibanaSpaceObjectParameter, includeReferences bool) map[string]map[string]interface{} {
+	objects := map[string]map[string]interface{}{}
+	for _, requested := range requestedObjects {
+		key := fakeObjectKey(requested.Type, requested.ID)
+		if f.spaceObjects(sourceSpace)[key] != nil {
+			objects[key] = f.spaceObjects(sourceSpace)[key]
+		}
+	}
+	if includeReferences {
+		f.addReferences(sourceSpace, objects)
+	}
+
+	return objects
+}
+
+// copyObjects copy objects in target space and return the result like Kibana does
+// When createNewCopies is true, objects are copied with new id and their references are updated
+// Like Kibana 8, objects are also copied with another id, always the same in a space so copies are overwritten
+func (f *fakeKibana) copyObjects(targetSpace string, objects map[string]map[string]interface{}, overwrite map[string]bool, createNewCopies bool) map[string]interface{} {
+	if f.spaces[targetSpace] == nil {
+		return map[string]interface{}{
+			"success":      false,
+			"successCount": 0,
+			"errors": []interface{}{
+				map[string]interface{}{
+					"statusCode": http.StatusNotFound,
+					"error":      "Not Found",
+					"message":    fmt.Sprintf("Saved object [space/%s] not found", targetSpace),
+				},
+			},
+		}
+	}
+
+	destinationIDs := map[string]string{}
+	for key, object := range objects {
+		destinationIDs[key] = object["id"].(string)
+		if createNewCopies {
+			f.copies++
+			destinationIDs[key] = fmt.Sprintf("%s-copy-%d", object["id"], f.copies)
+		} else if f.isVersion8() {
+			destinationIDs[key] = fmt.Sprintf("%s-%s", object["id"], targetSpace)
+		}
+	}
+
+	successCount := 0
+	successResults := make([]interface{}, 0)
+	errors := make([]interface{}, 0)
+	for key, object := range objects {
+		destinationKey := fakeObjectKey(object["type"].(string), destinationIDs[key])
+		if !createNewCopies && f.spaceObjects(targetSpace)[destinationKey] != nil && !overwrite[key] {
+			errors = append(errors, map[string]interface{}{
+				"id":   object["id"],
+				"type": object["type"],
+				"error": map[string]interface{}{
+					"type":          "conflict",
+					"destinationId": destinationIDs[key],
+				},
+			})
+			continue
+		}
+		copied := map[string]interface{}{}
+		for field, value := range object {
+			copied[field] = value
+		}
+		copied["id"] = destinationIDs[key]
+		if destinationIDs[key] != object["id"] {
+			copied["originId"] = object["id"]
+		}
+		if references, ok := object["references"].([]interface{}); ok {
+			copiedReferences := make([]interface{}, 0, len(references))
+			for _, rawReference := range references {
+				reference := rawReference.(map[string]interface{})
+				copiedReference := map[string]interface{}{}
+				for field, value := range reference {
+					copiedReference[field] = value
+				}
+				if destinationID, ok := destinationIDs[fakeObjectKey(reference["type"].(string), reference["id"].(string))]; ok {
+					copiedReference["id"] = destinationID
+				}
+				copiedReferences = append(copiedReferences, copiedReference)
+			}
+			copied["references"] = copiedReferences
+		}
+		f.setVersion8Fields(copied)
+		f.spaceObjects(targetSpace)[destinationKey] = copied
+		successCount++
+
+		successResult := map[string]interface{}{
+			"id":   object["id"],
+			"type": object["type"],
+		}
+		if destinationIDs[key] != object["id"] {
+			successResult["destinationId"] = destinationIDs[key]
+		}
+		successResults = append(successResults, successResult)
+	}
+
+	return map[string]interface{}{
+		"success":        len(errors) == 0,
+		"successCount":   successCount,
+		"successResults": successResults,
+		"errors":         errors,
+	}
+}
+
+func (f *fakeKibana) handleUpdateObjectsSpaces(w http.ResponseWriter, r *http.Request, space string) {
+	request := &struct {
+		Objects        []kbapi.KibanaSpaceObjectParameter `json:"objects"`
+		SpacesToAdd    []string                           `json:"spacesToAdd"`
+		SpacesToRemove []string                           `json:"spacesToRemove"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		fakeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	results := make([]interface{}, 0, len(request.Objects))
+	for _, requested := range request.Objects {
+		key := fakeObjectKey(requested.Type, requested.ID)
+		object := f.spaceObjects(space)[key]
+		if object == nil {
+			results = append(results, map[string]interface{}{
+				"type":   requested.Type,
+				"id":     requested.ID,
+				"spaces": []interface{}{},
+				"error": map[string]interface{}{
+					"statusCode": http.StatusNotFound,
+					"error":      "Not Found",
+					"message":    fmt.Sprintf("Saved object [%s/%s] not found", requested.Type, requested.ID),
+				},
+			})
+			continue
+		}
+
+		for _, spaceToAdd := range request.SpacesToAdd {
+			f.spaceObjects(spaceToAdd)[key] = object
+		}
+		for _, spaceToRemove := range request.SpacesToRemove {
+			delete(f.spaceObjects(spaceToRemove), key)
+		}
+		object["namespaces"] = f.objectSpaces(key, object)
+
+		results = append(results, map[string]interface{}{
+			"type":   requested.Type,
+			"id":     requested.ID,
+			"spaces": object["namespaces"],
+		})
+	}
+
+	fakeJSON(w, http.StatusOK, map[string]interface{}{"objects": results})
+}
+
+func (f *fakeKibana) handleGetShareableReferences(w http.ResponseWriter, r *http.Request, space string) {
+	request := &struct {
+		Objects []kbapi.KibanaSpaceObjectParameter `json:"objects"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		fakeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	objects := f.copiedObjects(space, request.Objects, true)
+
+	results := make([]interface{}, 0, len(objects))
+	for key, object := range objects {
+		results = append(results, map[string]interface{}{
+			"type":   object["type"],
+			"id":     object["id"],
+			"spaces": f.objectSpaces(key, object),
+		})
+	}
+	for _, requested := range request.Objects {
+		if objects[fakeObjectKey(requested.Type, requested.ID)] == nil {
+			results = append(results, map[string]interface{}{
+				"type":      requested.Type,
+				"id":        requested.ID,
+				"spaces":    []interface{}{},
+				"isMissing": true,
+			})
+		}
+	}
+
+	fakeJSON(w, http.StatusOK, map[string]interface{}{"objects": results})
+}
+
+// objectSpaces return the sorted spaces where the object is shared
+func (f *fakeKibana) objectSpaces(key string, object map[string]interface{}) []interface{} {
+	spaces := make([]string, 0)
+	for space, objects := range f.objects {
+		if objects[key] != nil && reflect.ValueOf(objects[key]).Pointer() == reflect.ValueOf(object).Pointer() {
+			spaces = append(spaces, space)
+		}
+	}
+	sort.Strings(spaces)
+
+	results := make([]interface{}, 0, len(spaces))
+	for _, space := range spaces {
+		results = append(results, space)
+	}
+
+	return results
+}
+
+// addReferences permit to add recursively the objects referenced by objects
+func (f *fakeKibana) addReferences(space string, objects map[string]map[string]interface{}) {
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		keys = append(keys, key)
+	}
+
+	for len(keys) > 0 {
+		object := objects[keys[0]]
+		keys = keys[1:]
+
+		references, _ := object["references"].([]interface{})
+		for _, rawReference := range references {
+			reference := rawReference.(map[string]interface{})
+			key := fakeObjectKey(reference["type"].(string), reference["id"].(string))
+			if objects[key] == nil && f.spaceObjects(space)[key] != nil {
+				objects[key] = f.spaceObjects(space)[key]
+				keys = append(keys, key)
+			}
+		}
+	}
+}
+
+// testResourceDataUpdate return resource data to update the resource state with the raw config, like Terraform does on apply
+func testResourceDataUpdate(t *testing.T, r *schema.Resource, state *terraform.InstanceState, raw map[string]interface{}, meta interface{}) *schema.ResourceData {
+	t.Helper()
+
+	diff, err := r.Diff(context.Background(), state, terraform.NewResourceConfigRaw(raw), meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := schema.InternalMap(r.Schema).Data(state, diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return d
+}
+
+// testCheckDiags permit to fail the test if diagnostics contain error
+func testCheckDiags(t *testing.T, diags diag.Diagnostics) {
+	t.Helper()
+
+	for _, d := range diags {
+		if d.Severity == diag.Error {
+			t.Fatalf("Unexpected error: %s %s", d.Summary, d.Detail)
+		}
+	}
+}
+
+// testCheckDiagsError permit to fail the test if diagnostics not contain error with the message
+func testCheckDiagsError(t *testing.T, diags diag.Diagnostics, message string) {
+	t.Helper()
+
+	for _, d := range diags {
+		if d.Severity == diag.Error && strings.Contains(d.Summary, message) {
+			return
+		}
+	}
+	t.Fatalf("Error %q expected, got %+v", message, diags)
+}
+
+// testCheckDiagsWarning permit to fail the test if diagnostics not contain warning
+func testCheckDiagsWarning(t *testing.T, diags diag.Diagnostics) {
+	t.Helper()
+
+	for _, d := range diags {
+		if d.Severity == diag.Warning {
+			return
+		}
+	}
+	t.Fatalf("Warning expected, got %+v", diags)
+}
+
+func fakeJSON(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(data)
+}
+
+func fakeError(w http.ResponseWriter, statusCode int, message string) {
+	fakeJSON(w, statusCode, map[string]interface{}{
+		"statusCode": statusCode,
+		"error":      http.StatusText(statusCode),
+		"message":    message,
+	})
+}
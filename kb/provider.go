@@ -1,14 +1,19 @@
 package kb
 
 import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
 	"net/url"
+	"sync"
 	"time"
 
 	kibana "github.com/ggsood/go-kibana-rest/v7"
 	"github.com/ggsood/go-kibana-rest/v7/kbapi"
+	"github.com/go-resty/resty/v2"
 
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
-	"github.com/hashicorp/terraform-plugin-sdk/terraform"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
@@ -17,16 +22,25 @@ type ProviderConf struct {
 	rawUrl          string
 	insecure        bool
 	caCertFiles     []string
+	clientCerts     []tls.Certificate
 	username        string
 	password        string
+	apiKey          string
 	parsedUrl       *url.URL
 	maxRetry        int
 	waitBeforeRetry int
+	maxWaitRetry    int
+	maxElapsedRetry int
 	debug           bool
+	version         *kibanaVersion
+
+	// The Kibana client is shared by all resources and built on first successful use
+	client      *kibana.Client
+	clientMutex sync.Mutex
 }
 
 // Provider define kibana provider
-func Provider() terraform.ResourceProvider {
+func Provider() *schema.Provider {
 	return &schema.Provider{
 		Schema: map[string]*schema.Schema{
 			"url": {
@@ -47,6 +61,13 @@ func Provider() terraform.ResourceProvider {
 				DefaultFunc: schema.EnvDefaultFunc("KIBANA_PASSWORD", nil),
 				Description: "Password to use to connect to Kibana using basic auth",
 			},
+			"api_key": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+				DefaultFunc: schema.EnvDefaultFunc("KIBANA_API_KEY", nil),
+				Description: "Base64 encoded API key to use to connect to Kibana. It can't be used with username and password",
+			},
 			"cacert_files": {
 				Type:        schema.TypeSet,
 				Optional:    true,
@@ -55,6 +76,33 @@ func Provider() terraform.ResourceProvider {
 					Type: schema.TypeString,
 				},
 			},
+			"client_cert_file": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				DefaultFunc:   schema.EnvDefaultFunc("KIBANA_CLIENT_CERT_FILE", nil),
+				ConflictsWith: []string{"client_cert"},
+				Description:   "The client certificate path to use for mutual TLS authentication",
+			},
+			"client_key_file": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				DefaultFunc:   schema.EnvDefaultFunc("KIBANA_CLIENT_KEY_FILE", nil),
+				ConflictsWith: []string{"client_key"},
+				Description:   "The client private key path to use for mutual TLS authentication",
+			},
+			"client_cert": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ConflictsWith: []string{"client_cert_file"},
+				Description:   "The client certificate as PEM string to use for mutual TLS authentication",
+			},
+			"client_key": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Sensitive:     true,
+				ConflictsWith: []string{"client_key_file"},
+				Description:   "The client private key as PEM string to use for mutual TLS authentication",
+			},
 			"insecure": {
 				Type:        schema.TypeBool,
 				Optional:    true,
@@ -65,13 +113,25 @@ func Provider() terraform.ResourceProvider {
 				Type:        schema.TypeInt,
 				Optional:    true,
 				Default:     6,
-				Description: "Nummber time it retry connexion before failed",
+				Description: "Number time it retry API call before failed, when Kibana is unreachable or return transient error",
 			},
 			"wait_before_retry": {
 				Type:        schema.TypeInt,
 				Optional:    true,
 				Default:     10,
-				Description: "Wait time in second before retry connexion",
+				Description: "Initial wait time in second before retry API call. It grow exponentially on each retry",
+			},
+			"max_wait_before_retry": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Default:     60,
+				Description: "Maximum wait time in second before retry API call",
+			},
+			"max_retry_elapsed_time": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Default:     0,
+				Description: "Maximum time in second spent to retry an API call. 0 mean no limit",
 			},
 			"debug": {
 				Type:        schema.TypeBool,
@@ -87,33 +147,127 @@ func Provider() terraform.ResourceProvider {
 			"kibana_object":            resourceKibanaObject(),
 			"kibana_logstash_pipeline": resourceKibanaLogstashPipeline(),
 			"kibana_copy_object":       resourceKibanaCopyObject(),
+			"kibana_object_spaces":     resourceKibanaObjectSpaces(),
 		},
 
-		ConfigureFunc: providerConfigure,
+		ConfigureContextFunc: providerConfigure,
 	}
 }
 
-func providerConfigure(d *schema.ResourceData) (interface{}, error) {
+func providerConfigure(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
 	rawUrl := d.Get("url").(string)
 	parsedUrl, err := url.Parse(rawUrl)
 	if err != nil {
-		return nil, err
+		return nil, diagAttributeError("url", err)
+	}
+
+	username := d.Get("username").(string)
+	password := d.Get("password").(string)
+	apiKey := d.Get("api_key").(string)
+	if apiKey != "" && (username != "" || password != "") {
+		return nil, diagAttributeError("api_key", errors.New("api_key can't be used with username and password, you need to choose one authentication method"))
+	}
+
+	clientCerts, err := loadClientCertificates(d)
+	if err != nil {
+		return nil, diag.FromErr(err)
 	}
 
 	return &ProviderConf{
 		rawUrl:          rawUrl,
 		insecure:        d.Get("insecure").(bool),
 		caCertFiles:     convertArrayInterfaceToArrayString(d.Get("cacert_files").(*schema.Set).List()),
-		username:        d.Get("username").(string),
-		password:        d.Get("password").(string),
+		clientCerts:     clientCerts,
+		username:        username,
+		password:        password,
+		apiKey:          apiKey,
 		parsedUrl:       parsedUrl,
 		maxRetry:        d.Get("retry").(int),
 		waitBeforeRetry: d.Get("wait_before_retry").(int),
+		maxWaitRetry:    d.Get("max_wait_before_retry").(int),
+		maxElapsedRetry: d.Get("max_retry_elapsed_time").(int),
 		debug:           d.Get("debug").(bool),
 	}, nil
 }
 
-func getClient(conf *ProviderConf) (*kibana.Client, error) {
+// loadClientCertificates permit to load the client certificate used for mutual TLS authentication
+// Certificate and key can be provided as file path or as PEM string
+func loadClientCertificates(d *schema.ResourceData) ([]tls.Certificate, error) {
+	certPEM := d.Get("client_cert").(string)
+	keyPEM := d.Get("client_key").(string)
+
+	if certFile := d.Get("client_cert_file").(string); certFile != "" {
+		data, err := ioutil.ReadFile(certFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error when read client certificate file %s", certFile)
+		}
+		certPEM = string(data)
+	}
+	if keyFile := d.Get("client_key_file").(string); keyFile != "" {
+		data, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error when read client key file %s", keyFile)
+		}
+		keyPEM = string(data)
+	}
+
+	if certPEM == "" && keyPEM == "" {
+		return nil, nil
+	}
+	if certPEM == "" {
+		return nil, errors.New("Client key is set but client certificate is missing, you need to set client_cert_file or client_cert")
+	}
+	if keyPEM == "" {
+		return nil, errors.New("Client certificate is set but client key is missing, you need to set client_key_file or client_key")
+	}
+
+	cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return nil, errors.Wrap(err, "Error when load client certificate, check that the key match the certificate")
+	}
+
+	return []tls.Certificate{cert}, nil
+}
+
+// getClient return the Kibana client shared by all resources of the provider instance
+// It's built and checked against Kibana status until it succeeds, then the same client is reused
+// Errors are not cached, so a cancelled context or an unavailable Kibana don't break the next calls
+// All API calls made with the returned client are bound to the context, so they stop when it's cancelled
+func getClient(ctx context.Context, conf *ProviderConf) (*kibana.Client, error) {
+	conf.clientMutex.Lock()
+	defer conf.clientMutex.Unlock()
+
+	if conf.client == nil {
+		client, err := newClient(ctx, conf)
+		if err != nil {
+			return nil, err
+		}
+		conf.client = client
+	}
+
+	return withContext(ctx, conf.client), nil
+}
+
+// withContext return a Kibana client that share the connections of client, but bind all its API calls to the context
+func withContext(ctx context.Context, client *kibana.Client) *kibana.Client {
+	restyClient := resty.NewWithClient(client.Client.GetClient()).
+		SetHostURL(client.Client.HostURL)
+	restyClient.Header = client.Client.Header.Clone()
+	restyClient.UserInfo = client.Client.UserInfo
+	restyClient.OnBeforeRequest(func(c *resty.Client, r *resty.Request) error {
+		r.SetContext(ctx)
+		return nil
+	})
+	restyClient.OnAfterResponse(checkResponseError)
+
+	return &kibana.Client{
+		Client: restyClient,
+		API:    kbapi.New(restyClient),
+	}
+}
+
+// newClient permit to build the Kibana client and check Kibana version
+func newClient(ctx context.Context, conf *ProviderConf) (*kibana.Client, error) {
 	if conf.debug {
 		log.SetLevel(log.DebugLevel)
 	}
@@ -134,36 +288,48 @@ func getClient(conf *ProviderConf) (*kibana.Client, error) {
 		return nil, err
 	}
 
+	if len(conf.clientCerts) > 0 {
+		client.Client.SetCertificates(conf.clientCerts...)
+	}
+
+	// API key replace the basic auth set by default on client
+	if conf.apiKey != "" {
+		client.Client.UserInfo = nil
+		client.Client.SetHeader("Authorization", "ApiKey "+conf.apiKey)
+	}
+
+	// Retry all API calls on transient error
+	// It must be the last transport settings, because TLS settings need the default transport
+	client.Client.SetTransport(newRetryTransport(client.Client.GetClient().Transport, retryPolicy{
+		MaxRetry:       conf.maxRetry,
+		WaitTime:       time.Duration(conf.waitBeforeRetry) * time.Second,
+		MaxWaitTime:    time.Duration(conf.maxWaitRetry) * time.Second,
+		MaxElapsedTime: time.Duration(conf.maxElapsedRetry) * time.Second,
+	}))
+
 	// Test connection and check kibana version
-	nbFailed := 0
-	isOnline := false
-	var kibanaStatus kbapi.KibanaStatus
-	for isOnline == false {
-		kibanaStatus, err = client.API.KibanaStatus.Get()
-		if err == nil {
-			isOnline = true
-		} else {
-			if nbFailed == conf.maxRetry {
-				return nil, err
-			}
-			nbFailed++
-			time.Sleep(time.Duration(conf.waitBeforeRetry) * time.Second)
-		}
+	kibanaStatus, err := withContext(ctx, client).API.KibanaStatus.Get()
+	if err != nil {
+		return nil, err
 	}
 
 	if kibanaStatus == nil {
 		return nil, errors.New("Status is empty, something wrong with Kibana?")
 	}
 
-	version := kibanaStatus["version"].(map[string]interface{})["number"].(string)
+	version, err := getKibanaVersion(kibanaStatus)
+	if err != nil {
+		return nil, err
+	}
 	log.Debugf("Server: %s", version)
 
-	if version < "7.0.0" {
-		return nil, errors.New("Kibana is older than 7.0.0")
-	} else if version >= "8.0.0" {
-		return nil, errors.New("Kibana is version 8.0.0 or newer and support has not been tested")
+	if version.Major < 7 {
+		return nil, errors.Errorf("Kibana is version %s, it's older than 7.0.0", version)
+	} else if version.Major >= 9 {
+		return nil, errors.Errorf("Kibana is version %s, 9.0.0 or newer and support has not been tested", version)
 	}
+	conf.version = version
 
-	log.Printf("[INFO] Using Kibana 7")
+	log.Printf("[INFO] Using Kibana %d", version.Major)
 	return client, nil
 }
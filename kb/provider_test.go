@@ -1,16 +1,30 @@
 package kb
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
-	"github.com/hashicorp/terraform-plugin-sdk/terraform"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/sirupsen/logrus"
 	prefixed "github.com/x-cray/logrus-prefixed-formatter"
 )
 
-var testAccProviders map[string]terraform.ResourceProvider
+var testAccProviders map[string]*schema.Provider
 var testAccProvider *schema.Provider
 
 func init() {
@@ -20,25 +34,25 @@ func init() {
 	logrus.SetLevel(logrus.InfoLevel)
 
 	// Init provider
-	testAccProvider = Provider().(*schema.Provider)
-	configureFunc := testAccProvider.ConfigureFunc
-	testAccProvider.ConfigureFunc = func(d *schema.ResourceData) (interface{}, error) {
-		return configureFunc(d)
+	testAccProvider = Provider()
+	configureFunc := testAccProvider.ConfigureContextFunc
+	testAccProvider.ConfigureContextFunc = func(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
+		return configureFunc(ctx, d)
 	}
-	testAccProviders = map[string]terraform.ResourceProvider{
+	testAccProviders = map[string]*schema.Provider{
 		"kibana": testAccProvider,
 	}
 
 }
 
 func TestProvider(t *testing.T) {
-	if err := Provider().(*schema.Provider).InternalValidate(); err != nil {
+	if err := Provider().InternalValidate(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 }
 
 func TestProvider_impl(t *testing.T) {
-	var _ terraform.ResourceProvider = Provider()
+	var _ *schema.Provider = Provider()
 }
 
 func testAccPreCheck(t *testing.T) {
@@ -47,3 +61,215 @@ func testAccPreCheck(t *testing.T) {
 	}
 
 }
+
+// testAccPreCheckKibanaCapabilities permit to skip acceptance test when Kibana not support the resource
+func testAccPreCheckKibanaCapabilities(t *testing.T, resourceName string) {
+	conf := &ProviderConf{
+		rawUrl:   os.Getenv("KIBANA_URL"),
+		username: os.Getenv("KIBANA_USERNAME"),
+		password: os.Getenv("KIBANA_PASSWORD"),
+		apiKey:   os.Getenv("KIBANA_API_KEY"),
+	}
+	if _, err := getClient(context.Background(), conf); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkCapabilities(kibanaCapabilities[resourceName], resourceName, conf.version, func(attribute string) bool { return false }); err != nil {
+		t.Skip(err.Error())
+	}
+}
+
+func TestGetClientIsBuiltOnce(t *testing.T) {
+	var nbStatusCall int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&nbStatusCall, 1)
+		fmt.Fprint(w, `{"version": {"number": "7.9.2"}}`)
+	}))
+	defer server.Close()
+
+	conf := &ProviderConf{
+		rawUrl: server.URL,
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := getClient(context.Background(), conf); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if nbStatusCall != 1 {
+		t.Fatalf("Kibana status must be checked once, got %d calls", nbStatusCall)
+	}
+}
+
+func TestGetClientWithAPIKey(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		fmt.Fprint(w, `{"version": {"number": "7.9.2"}}`)
+	}))
+	defer server.Close()
+
+	conf := &ProviderConf{
+		rawUrl: server.URL,
+		apiKey: "dGVzdDp0ZXN0",
+	}
+
+	if _, err := getClient(context.Background(), conf); err != nil {
+		t.Fatal(err)
+	}
+	if authorization != "ApiKey dGVzdDp0ZXN0" {
+		t.Fatalf("Authorization header must use API key, got %q", authorization)
+	}
+}
+
+func TestProviderConfigureAuthConflict(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, Provider().Schema, map[string]interface{}{
+		"url":      "http://localhost:5601",
+		"username": "elastic",
+		"api_key":  "dGVzdDp0ZXN0",
+	})
+
+	if _, diags := providerConfigure(context.Background(), d); !diags.HasError() {
+		t.Fatal("api_key and username must be exclusive")
+	}
+}
+
+func TestLoadClientCertificates(t *testing.T) {
+	cert, key := testGenerateCertificate(t)
+	_, otherKey := testGenerateCertificate(t)
+
+	d := schema.TestResourceDataRaw(t, Provider().Schema, map[string]interface{}{
+		"url":         "http://localhost:5601",
+		"client_cert": cert,
+		"client_key":  key,
+	})
+	certs, err := loadClientCertificates(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 1 {
+		t.Fatalf("One client certificate expected, got %d", len(certs))
+	}
+
+	d = schema.TestResourceDataRaw(t, Provider().Schema, map[string]interface{}{
+		"url":         "http://localhost:5601",
+		"client_cert": cert,
+		"client_key":  otherKey,
+	})
+	if _, err = loadClientCertificates(d); err == nil {
+		t.Fatal("Client certificate and key that not match must failed")
+	}
+
+	d = schema.TestResourceDataRaw(t, Provider().Schema, map[string]interface{}{
+		"url":         "http://localhost:5601",
+		"client_cert": cert,
+	})
+	if _, err = loadClientCertificates(d); err == nil {
+		t.Fatal("Client certificate without key must failed")
+	}
+}
+
+// testGenerateCertificate permit to generate self signed certificate and key as PEM string
+func testGenerateCertificate(t *testing.T) (string, string) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "terraform-test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	key := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	return string(cert), string(key)
+}
+
+func TestGetClientKibanaVersion(t *testing.T) {
+	versions := map[string]bool{
+		"6.8.12":         false,
+		"7.17.0":         true,
+		"8.0.0-SNAPSHOT": true,
+		"8.11.1":         true,
+		"9.0.0":          false,
+	}
+
+	for version, isSupported := range versions {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"version": {"number": "%s"}}`, version)
+		}))
+
+		_, err := getClient(context.Background(), &ProviderConf{rawUrl: server.URL})
+		if isSupported && err != nil {
+			t.Errorf("Kibana %s must be supported: %s", version, err)
+		} else if !isSupported && err == nil {
+			t.Errorf("Kibana %s must not be supported", version)
+		}
+
+		server.Close()
+	}
+}
+
+func TestGetClientContextCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	conf := &ProviderConf{
+		rawUrl:          server.URL,
+		maxRetry:        10,
+		waitBeforeRetry: 10,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	startTime := time.Now()
+	if _, err := getClient(ctx, conf); err == nil {
+		t.Fatal("Get client must failed when context is cancelled")
+	}
+	if time.Since(startTime) > 5*time.Second {
+		t.Fatal("Get client must stop retry when context is cancelled")
+	}
+}
+
+func TestGetClientRetryAfterFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"version": {"number": "7.9.2"}}`)
+	}))
+	defer server.Close()
+
+	conf := &ProviderConf{
+		rawUrl: server.URL,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := getClient(ctx, conf); err == nil {
+		t.Fatal("Get client must failed when context is cancelled")
+	}
+
+	if _, err := getClient(context.Background(), conf); err != nil {
+		t.Fatalf("Get client must be built again after a failure: %s", err)
+	}
+}
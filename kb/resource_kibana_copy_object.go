@@ -2,31 +2,60 @@
 // API documentation: https://www.elastic.co/guide/en/kibana/master/spaces-api-copy-saved-objects.html
 // Supported version:
 //  - v7
+//  - v8
 
 package kb
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
+	kibana "github.com/ggsood/go-kibana-rest/v7"
 	"github.com/ggsood/go-kibana-rest/v7/kbapi"
 
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
+// copyIgnoredFields is the list of fields ignored when compare objects of source space and target spaces
+// Kibana can set the origin of copied objects
+var copyIgnoredFields = append([]string{"originId"}, defaultIgnoredFields...)
+
 // Resource specification to handle kibana save object
 func resourceKibanaCopyObject() *schema.Resource {
 	return &schema.Resource{
-		Create: resourceKibanaCopyObjectCreate,
-		Read:   resourceKibanaCopyObjectRead,
-		Update: resourceKibanaCopyObjectUpdate,
-		Delete: resourceKibanaCopyObjectDelete,
+		CreateContext: resourceKibanaCopyObjectCreate,
+		ReadContext:   resourceKibanaCopyObjectRead,
+		UpdateContext: resourceKibanaCopyObjectUpdate,
+		DeleteContext: resourceKibanaCopyObjectDelete,
+
+		Importer: &schema.ResourceImporter{
+			StateContext: resourceKibanaCopyObjectImport,
+		},
+
+		CustomizeDiff: customdiff.All(
+			checkKibanaCapabilities("kibana_copy_object"),
+			customizeDiffKibanaCopyObject,
+		),
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Read:   schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
 
 		Schema: map[string]*schema.Schema{
 			"name": {
-				Type:     schema.TypeString,
-				Required: true,
-				ForceNew: true,
+				Type:             schema.TypeString,
+				Required:         true,
+				DiffSuppressFunc: suppressImportedName,
 			},
 			"source_space": {
 				Type:     schema.TypeString,
@@ -66,33 +95,104 @@ func resourceKibanaCopyObject() *schema.Resource {
 				Optional: true,
 				Default:  true,
 			},
-			"force_update": {
+			"create_new_copies": {
 				Type:     schema.TypeBool,
 				Optional: true,
+				ForceNew: true,
+				Default:  false,
+			},
+			"delete_references": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"overwrite_objects": {
+				Type:     schema.TypeSet,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"id": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"type": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+					},
+				},
+			},
+			"status": {
+				Type:     schema.TypeList,
 				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"space": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"success": {
+							Type:     schema.TypeBool,
+							Computed: true,
+						},
+						"success_count": {
+							Type:     schema.TypeInt,
+							Computed: true,
+						},
+						"errors": {
+							Type:     schema.TypeList,
+							Computed: true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
+						"destination_ids": {
+							Type:     schema.TypeMap,
+							Computed: true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
+						"synced": {
+							Type:     schema.TypeBool,
+							Computed: true,
+						},
+					},
+				},
+			},
+			"force_update": {
+				Type:       schema.TypeBool,
+				Optional:   true,
+				Computed:   true,
+				Deprecated: "Objects are copied again when they differ from source space, force_update is not needed anymore",
 			},
 		},
 	}
 }
 
 // Copy objects in Kibana
-func resourceKibanaCopyObjectCreate(d *schema.ResourceData, meta interface{}) error {
+func resourceKibanaCopyObjectCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	name := d.Get("name").(string)
 
-	err := copyObject(d, meta)
-	if err != nil {
-		return err
+	diags := copyObject(ctx, d, meta)
+	if diags.HasError() {
+		// Objects can be copied in some spaces even if others failed, so keep track of them
+		if len(d.Get("status").([]interface{})) > 0 {
+			d.SetId(name)
+		}
+		return diags
 	}
 
 	d.SetId(name)
 
 	log.Infof("Copy objects %s successfully", name)
 
-	return resourceKibanaCopyObjectRead(d, meta)
+	return resourceKibanaCopyObjectRead(ctx, d, meta)
 }
 
-// Read object on kibana
-func resourceKibanaCopyObjectRead(d *schema.ResourceData, meta interface{}) error {
+// Read objects on source space and target spaces
+// The target spaces where objects are missing or differ from source space are not synced on status, so they are copied again
+func resourceKibanaCopyObjectRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 
 	id := d.Id()
 	sourceSpace := d.Get("source_space").(string)
@@ -100,7 +200,8 @@ func resourceKibanaCopyObjectRead(d *schema.ResourceData, meta interface{}) erro
 	objects := buildCopyObjects(d.Get("object").(*schema.Set).List())
 	includeReference := d.Get("include_reference").(bool)
 	overwrite := d.Get("overwrite").(bool)
-	forceUpdate := d.Get("force_update").(bool)
+	createNewCopies := d.Get("create_new_copies").(bool)
+	destinationIDs := copyDestinationIDs(d.Get("status").([]interface{}))
 
 	log.Debugf("Resource id:  %s", id)
 	log.Debugf("Source space: %s", sourceSpace)
@@ -108,19 +209,87 @@ func resourceKibanaCopyObjectRead(d *schema.ResourceData, meta interface{}) erro
 	log.Debugf("Objects: %+v", objects)
 	log.Debugf("Include reference: %t", includeReference)
 	log.Debugf("Overwrite: %t", overwrite)
-	log.Debugf("force_update: %t", forceUpdate)
+	log.Debugf("Create new copies: %t", createNewCopies)
 
-	// @ TODO
-	// A good when is to check if already exported object is the same that original space
-	// To avoid this hard code, we juste use force_update and overwrite field
-	// It make same result but in bad way on terraform spirit
+	client, err := getClient(ctx, meta.(*ProviderConf))
+	if err != nil {
+		return diagFromKibanaError(err)
+	}
+
+	sourceData, err := exportExistingObjects(client, objects, includeReference, sourceSpace)
+	if err != nil {
+		return diagFromKibanaError(err)
+	}
+	if len(sourceData) == 0 {
+		log.Warnf("Objects %s not found in source space %s - removing from state", id, sourceSpace)
+		d.SetId("")
+		return diagWarning("Objects %s not found in source space %s - removing from state", id, sourceSpace)
+	}
+	sourceHashes, err := hashSavedObjects(string(sourceData), copyIgnoredFields)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	syncedSpaces := make(map[string]bool, len(targetSpaces))
+	foundDestinationIDs := map[string]map[string]interface{}{}
+	for _, targetSpace := range targetSpaces {
+		// New copies have their own id and can be changed, so only check that they still exist
+		if createNewCopies {
+			synced, err := isNewCopySynced(client, objects, destinationIDs[targetSpace], targetSpace)
+			if err != nil {
+				return diagFromKibanaError(err)
+			}
+			if !synced {
+				log.Infof("Copies of objects %s are missing in space %s", id, targetSpace)
+			}
+			syncedSpaces[targetSpace] = synced
+			continue
+		}
+
+		// Kibana can copy objects with another id, so they are read with the destination id and compared by source id
+		var targetData []byte
+		copiedObjects := buildCopiedObjects(objects, destinationIDs[targetSpace])
+		if len(copiedObjects) > 0 {
+			targetData, err = exportExistingObjects(client, copiedObjects, includeReference, targetSpace)
+			if err != nil && !isNotFoundError(err) {
+				return diagFromKibanaError(err)
+			}
+		}
+		targetHashes, err := hashCopiedObjects(string(targetData), destinationIDs[targetSpace])
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		synced := isCopySynced(sourceHashes, targetHashes, overwrite)
+		if !synced {
+			log.Infof("Objects %s in space %s are not the same as in source space %s", id, targetSpace, sourceSpace)
+		}
+		syncedSpaces[targetSpace] = synced
+
+		// Spaces without status, like after import, record the objects found with their source id
+		// So they are deleted on destroy
+		if _, ok := destinationIDs[targetSpace]; !ok {
+			targetObjects, err := parseSavedObjects(string(targetData))
+			if err != nil {
+				return diag.FromErr(err)
+			}
+			foundDestinationIDs[targetSpace] = map[string]interface{}{}
+			for _, object := range targetObjects {
+				key := savedObjectKey(object["type"], object["id"])
+				if _, ok := sourceHashes[key]; ok {
+					foundDestinationIDs[targetSpace][key] = object["id"]
+				}
+			}
+		}
+	}
 
-	d.Set("name", id)
 	d.Set("source_space", sourceSpace)
 	d.Set("target_spaces", targetSpaces)
+	d.Set("status", flattenSyncedStatus(d.Get("status").([]interface{}), syncedSpaces, foundDestinationIDs))
 	d.Set("object", objects)
 	d.Set("include_reference", includeReference)
 	d.Set("overwrite", overwrite)
+	d.Set("create_new_copies", createNewCopies)
 	d.Set("force_update", false)
 
 	log.Infof("Read resource %s successfully", id)
@@ -128,32 +297,249 @@ func resourceKibanaCopyObjectRead(d *schema.ResourceData, meta interface{}) erro
 	return nil
 }
 
+// isCopySynced return true if all objects of source space exist in target space
+// When copy overwrite objects, they must also be the same
+func isCopySynced(sourceHashes map[string]string, targetHashes map[string]string, overwrite bool) bool {
+	for key, sourceHash := range sourceHashes {
+		targetHash, ok := targetHashes[key]
+		if !ok {
+			log.Debugf("Object %s is missing", key)
+			return false
+		}
+		if overwrite && targetHash != sourceHash {
+			log.Debugf("Object %s differ", key)
+			return false
+		}
+	}
+
+	return true
+}
+
+// hashCopiedObjects permit to compute the hash of each copied object of NDJSON data, keyed by its type and id in source space
+// The ids of copied objects and of their references are replaced by the ids of source space, so hashes can be compared with source space
+func hashCopiedObjects(data string, destinationIDs map[string]string) (map[string]string, error) {
+	objects, err := normalizeSavedObjects(data, copyIgnoredFields)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceIDs := make(map[string]string, len(destinationIDs))
+	for key, destinationID := range destinationIDs {
+		parts := strings.SplitN(key, "/", 2)
+		if len(parts) == 2 {
+			sourceIDs[savedObjectKey(parts[0], destinationID)] = parts[1]
+		}
+	}
+
+	sourceObjects := make(map[string]map[string]interface{}, len(objects))
+	for key, object := range objects {
+		objectType := object["type"].(string)
+		if sourceID, ok := sourceIDs[key]; ok {
+			object["id"] = sourceID
+		}
+		if references, ok := object["references"].([]interface{}); ok {
+			for _, rawReference := range references {
+				reference, ok := rawReference.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				referenceType, _ := reference["type"].(string)
+				referenceID, _ := reference["id"].(string)
+				if sourceID, ok := sourceIDs[savedObjectKey(referenceType, referenceID)]; ok {
+					reference["id"] = sourceID
+				}
+			}
+			sortReferences(references)
+		}
+		sourceObjects[savedObjectKey(objectType, object["id"].(string))] = object
+	}
+
+	return hashNormalizedSavedObjects(sourceObjects)
+}
+
+// isNewCopySynced return true if the copies of all objects exist in target space
+func isNewCopySynced(client *kibana.Client, objects []map[string]string, destinationIDs map[string]string, space string) (bool, error) {
+	for _, object := range objects {
+		destinationID, ok := destinationIDs[savedObjectKey(object["type"], object["id"])]
+		if !ok {
+			log.Debugf("Object %s/%s is not copied", object["type"], object["id"])
+			return false, nil
+		}
+		copiedObject, err := client.API.KibanaSavedObject.Get(object["type"], destinationID, space)
+		if err != nil {
+			if isNotFoundError(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		if copiedObject == nil {
+			log.Debugf("Copy %s/%s of object %s is missing", object["type"], destinationID, object["id"])
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// customizeDiffKibanaCopyObject permit to copy again objects when they change in create new copies mode
+// Otherwise the previous copies would be kept in target spaces
+// It also plan to copy again objects in target spaces that are not synced with source space
+func customizeDiffKibanaCopyObject(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if d.Id() != "" && len(unsyncedSpaces(d.Get("status").([]interface{}), d.Get("target_spaces").(*schema.Set))) > 0 {
+		if err := d.SetNewComputed("status"); err != nil {
+			return err
+		}
+	}
+
+	if !d.Get("create_new_copies").(bool) {
+		return nil
+	}
+
+	for _, key := range []string{"object", "include_reference"} {
+		if d.HasChange(key) {
+			if err := d.ForceNew(key); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 // Update existing object in Kibana
-func resourceKibanaCopyObjectUpdate(d *schema.ResourceData, meta interface{}) error {
+func resourceKibanaCopyObjectUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	id := d.Id()
 
-	err := copyObject(d, meta)
-	if err != nil {
-		return err
+	// The name is only a label, objects are not copied again when it's renamed
+	if d.HasChange("name") && !d.HasChangesExcept("name") {
+		log.Infof("Renamed resource %s successfully", id)
+		return resourceKibanaCopyObjectRead(ctx, d, meta)
+	}
+
+	diags := copyObject(ctx, d, meta)
+	if diags.HasError() {
+		return diags
+	}
+
+	// Delete copied objects from spaces removed from target spaces
+	// The spaces where objects are copied are read from status, it's not changed when objects drift
+	oldTargetSpaces, newTargetSpaces := d.GetChange("target_spaces")
+	oldStatus, _ := d.GetChange("status")
+	removedSpaces := convertArrayInterfaceToArrayString(copiedSpaces(oldStatus.([]interface{}), oldTargetSpaces.(*schema.Set)).Difference(newTargetSpaces.(*schema.Set)).List())
+	if len(removedSpaces) > 0 {
+		oldObjects, _ := d.GetChange("object")
+		destinationIDs := copyDestinationIDs(oldStatus.([]interface{}))
+
+		client, err := getClient(ctx, meta.(*ProviderConf))
+		if err != nil {
+			return diagFromKibanaError(err)
+		}
+		for _, space := range removedSpaces {
+			copiedObjects := buildCopiedObjects(buildCopyObjects(oldObjects.(*schema.Set).List()), destinationIDs[space])
+			if err = deleteCopiedObjects(client, copiedObjects, d.Get("delete_references").(bool), space); err != nil {
+				return diagFromKibanaError(err)
+			}
+		}
 	}
 
 	log.Infof("Updated resource %s successfully", id)
 
-	return resourceKibanaCopyObjectRead(d, meta)
+	return resourceKibanaCopyObjectRead(ctx, d, meta)
+}
+
+// Import existing copy of objects
+// The ID is formated as source_space/target_space,target_space/type:id,type:id
+// The resource ID stay the import ID, name is kept from configuration
+func resourceKibanaCopyObjectImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	parts := strings.SplitN(d.Id(), "/", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+		return nil, errors.Errorf("Import ID %q must be formated as source_space/target_space,target_space/type:id,type:id", d.Id())
+	}
+
+	objects, err := parseObjectsID(parts[2])
+	if err != nil {
+		return nil, errors.Wrapf(err, "Import ID %q must be formated as source_space/target_space,target_space/type:id,type:id", d.Id())
+	}
+
+	log.Debugf("Import copy of objects %+v from space %s to spaces %s", objects, parts[0], parts[1])
+
+	d.Set("source_space", parts[0])
+	d.Set("target_spaces", strings.Split(parts[1], ","))
+	d.Set("object", objects)
+	d.Set("include_reference", true)
+	d.Set("overwrite", true)
+	d.Set("create_new_copies", false)
+	d.Set("delete_references", false)
+
+	return []*schema.ResourceData{d}, nil
 }
 
-// Delete object in Kibana is not supported
-// It just remove object from state
-func resourceKibanaCopyObjectDelete(d *schema.ResourceData, meta interface{}) error {
+// Delete copied objects from target spaces
+// Objects are deleted from all spaces where they are copied according to status, even if they drift
+func resourceKibanaCopyObjectDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	id := d.Id()
+	status := d.Get("status").([]interface{})
+	targetSpaces := convertArrayInterfaceToArrayString(copiedSpaces(status, d.Get("target_spaces").(*schema.Set)).List())
+	objects := buildCopyObjects(d.Get("object").(*schema.Set).List())
+	deleteReferences := d.Get("delete_references").(bool)
+	destinationIDs := copyDestinationIDs(status)
+
+	client, err := getClient(ctx, meta.(*ProviderConf))
+	if err != nil {
+		return diagFromKibanaError(err)
+	}
+
+	for _, space := range targetSpaces {
+		if err = deleteCopiedObjects(client, buildCopiedObjects(objects, destinationIDs[space]), deleteReferences, space); err != nil {
+			return diagFromKibanaError(err)
+		}
+	}
 
 	d.SetId("")
 
-	log.Infof("Delete object in not supported")
-	fmt.Printf("[INFO] Delete object in not supported - just removing from state")
+	log.Infof("Deleted copied objects %s successfully", id)
 	return nil
 
 }
 
+// deleteCopiedObjects permit to delete copied objects from target space
+// When deleteReferences is true, the objects referenced by copied objects are also deleted
+func deleteCopiedObjects(client *kibana.Client, objects []map[string]string, deleteReferences bool, space string) error {
+	if len(objects) == 0 {
+		log.Debugf("No object copied in space %s", space)
+		return nil
+	}
+
+	if deleteReferences {
+		data, err := exportExistingObjects(client, objects, true, space)
+		if err != nil {
+			if isNotFoundError(err) {
+				log.Warnf("Space %s not found", space)
+				return nil
+			}
+			return err
+		}
+		objects, err = parseSavedObjects(string(data))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, object := range objects {
+		err := client.API.KibanaSavedObject.Delete(object["type"], object["id"], space)
+		if err != nil {
+			if isNotFoundError(err) {
+				log.Warnf("Object %s/%s not found in space %s", object["type"], object["id"], space)
+				continue
+			}
+			return err
+		}
+		log.Debugf("Deleted object %s/%s in space %s", object["type"], object["id"], space)
+	}
+
+	return nil
+}
+
 // Build list of object to export
 func buildCopyObjects(raws []interface{}) []map[string]string {
 
@@ -170,24 +556,101 @@ func buildCopyObjects(raws []interface{}) []map[string]string {
 	return results
 }
 
+// buildCopiedObjects return the objects as they are copied in target space, with their destination id
+// Only the objects recorded on destination ids are returned, so objects that failed to be copied, like on conflict, are never touched
+// When destination ids are nil, because the space has no status, objects are expected with their source id
+func buildCopiedObjects(objects []map[string]string, destinationIDs map[string]string) []map[string]string {
+	results := make([]map[string]string, 0, len(objects))
+	for _, object := range objects {
+		copiedObject := map[string]string{
+			"type": object["type"],
+			"id":   object["id"],
+		}
+		if destinationIDs != nil {
+			destinationID, ok := destinationIDs[savedObjectKey(object["type"], object["id"])]
+			if !ok {
+				log.Debugf("Object %s/%s is not copied", object["type"], object["id"])
+				continue
+			}
+			copiedObject["id"] = destinationID
+		}
+		results = append(results, copiedObject)
+	}
+
+	return results
+}
+
+// copiedSpaces return the spaces where objects are copied, from status and target spaces
+// Target spaces are needed for state without status
+func copiedSpaces(status []interface{}, targetSpaces *schema.Set) *schema.Set {
+	spaces := schema.NewSet(targetSpaces.F, targetSpaces.List())
+	for _, raw := range status {
+		spaces.Add(raw.(map[string]interface{})["space"].(string))
+	}
+
+	return spaces
+}
+
+// copyDestinationIDs return the destination id of copied objects for each space, from status
+// Spaces without status are not on result
+func copyDestinationIDs(status []interface{}) map[string]map[string]string {
+	results := map[string]map[string]string{}
+	for _, raw := range status {
+		m := raw.(map[string]interface{})
+		destinationIDs := map[string]string{}
+		if rawDestinationIDs, ok := m["destination_ids"].(map[string]interface{}); ok {
+			for key, destinationID := range rawDestinationIDs {
+				destinationIDs[key] = destinationID.(string)
+			}
+		}
+		results[m["space"].(string)] = destinationIDs
+	}
+
+	return results
+}
+
 // Copy objects in Kibana
-func copyObject(d *schema.ResourceData, meta interface{}) error {
+// The result of each target space is stored on status, and objects listed on overwrite_objects are copied again with overwrite when they conflict
+func copyObject(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	name := d.Get("name").(string)
 	sourceSpace := d.Get("source_space").(string)
 	targetSpaces := convertArrayInterfaceToArrayString(d.Get("target_spaces").(*schema.Set).List())
 	objects := buildCopyObjects(d.Get("object").(*schema.Set).List())
 	includeReference := d.Get("include_reference").(bool)
 	overwrite := d.Get("overwrite").(bool)
+	overwriteObjects := buildCopyObjects(d.Get("overwrite_objects").(*schema.Set).List())
+	createNewCopies := d.Get("create_new_copies").(bool)
+
+	// New copies are only created in spaces where objects are not yet copied or where copies are missing
+	// Kibana not permit to overwrite objects when create new copies
+	copySpaces := targetSpaces
+	if createNewCopies {
+		oldTargetSpaces, newTargetSpaces := d.GetChange("target_spaces")
+		oldStatus, _ := d.GetChange("status")
+		spaces := newTargetSpaces.(*schema.Set).Difference(oldTargetSpaces.(*schema.Set))
+		for _, space := range unsyncedSpaces(oldStatus.([]interface{}), newTargetSpaces.(*schema.Set)) {
+			spaces.Add(space)
+		}
+		copySpaces = convertArrayInterfaceToArrayString(spaces.List())
+		overwrite = false
+	}
 
 	log.Debugf("Source space: %s", sourceSpace)
 	log.Debugf("Target spaces: %+v", targetSpaces)
 	log.Debugf("Objects: %+v", objects)
 	log.Debugf("Include reference: %t", includeReference)
 	log.Debugf("Overwrite: %t", overwrite)
+	log.Debugf("Overwrite objects: %+v", overwriteObjects)
+	log.Debugf("Create new copies: %t", createNewCopies)
+
+	if len(copySpaces) == 0 {
+		log.Debugf("Objects are already copied in all target spaces")
+		return nil
+	}
 
-	client, err := getClient(meta.(*ProviderConf))
+	client, err := getClient(ctx, meta.(*ProviderConf))
 	if err != nil {
-		return err
+		return diagFromKibanaError(err)
 	}
 
 	objectsParameter := make([]kbapi.KibanaSpaceObjectParameter, 0, 1)
@@ -198,19 +661,239 @@ func copyObject(d *schema.ResourceData, meta interface{}) error {
 		})
 	}
 
-	parameter := &kbapi.KibanaSpaceCopySavedObjectParameter{
-		Spaces:            targetSpaces,
-		Objects:           objectsParameter,
-		IncludeReferences: includeReference,
-		Overwrite:         overwrite,
+	parameter := &savedObjectCopyParameter{
+		KibanaSpaceCopySavedObjectParameter: &kbapi.KibanaSpaceCopySavedObjectParameter{
+			Spaces:            copySpaces,
+			Objects:           objectsParameter,
+			IncludeReferences: includeReference,
+			Overwrite:         overwrite,
+		},
+		CreateNewCopies: createNewCopies,
 	}
 
-	err = client.API.KibanaSpaces.CopySavedObjects(parameter, sourceSpace)
+	results, err := copySavedObjects(client, parameter, sourceSpace)
 	if err != nil {
-		return err
+		return diagFromKibanaError(err)
 	}
 
-	log.Debugf("Copy object for resource successfully: %s", name)
+	// Retry the conflicts on objects that must be overwritten
+	retries := buildCopyRetries(results, overwriteObjects)
+	if len(retries) > 0 {
+		log.Debugf("Retries: %+v", retries)
+		retryResults, err := resolveCopySavedObjectsErrors(client, objectsParameter, includeReference, createNewCopies, retries, sourceSpace)
+		if err != nil {
+			return diagFromKibanaError(err)
+		}
+		for space, retryResult := range retryResults {
+			results[space] = mergeCopyResults(results[space], retryResult, retries[space])
+		}
+	}
 
-	return nil
+	var diags diag.Diagnostics
+	for _, space := range copySpaces {
+		result, ok := results[space]
+		if !ok {
+			diags = append(diags, diag.Errorf("Kibana doesn't provide the result of copy in space %s", space)...)
+			continue
+		}
+		if !result.Success {
+			diags = append(diags, diagFromSavedObjectErrors("copy", space, result.Errors)...)
+		}
+	}
+
+	// Status is unknown when objects are copied again, so the previous status is the one from state
+	previousStatus, _ := d.GetChange("status")
+	if err = d.Set("status", flattenCopyStatus(targetSpaces, results, previousStatus.([]interface{}))); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if !diags.HasError() {
+		log.Debugf("Copy object for resource successfully: %s", name)
+	}
+
+	return diags
+}
+
+// buildCopyRetries return, for each space, the retries with overwrite of objects in conflict
+// Only objects listed on overwriteObjects are retried
+func buildCopyRetries(results map[string]*savedObjectImportResponse, overwriteObjects []map[string]string) map[string][]savedObjectCopyRetry {
+	overwriteKeys := map[string]bool{}
+	for _, object := range overwriteObjects {
+		overwriteKeys[savedObjectKey(object["type"], object["id"])] = true
+	}
+
+	retries := map[string][]savedObjectCopyRetry{}
+	for space, result := range results {
+		if result == nil || result.Success {
+			continue
+		}
+		for _, objectError := range result.Errors {
+			if objectError.Error.Type != "conflict" && objectError.Error.Type != "ambiguous_conflict" {
+				continue
+			}
+			if !overwriteKeys[savedObjectKey(objectError.Type, objectError.ID)] {
+				continue
+			}
+			retries[space] = append(retries[space], savedObjectCopyRetry{
+				Type:          objectError.Type,
+				ID:            objectError.ID,
+				Overwrite:     true,
+				DestinationID: objectError.Error.DestinationID,
+			})
+		}
+	}
+
+	return retries
+}
+
+// mergeCopyResults return the result of copy once objects are retried
+// Errors of retried objects are replaced by the result of retry
+func mergeCopyResults(result *savedObjectImportResponse, retryResult *savedObjectImportResponse, retries []savedObjectCopyRetry) *savedObjectImportResponse {
+	if result == nil {
+		return retryResult
+	}
+	if retryResult == nil {
+		return result
+	}
+
+	retriedKeys := map[string]bool{}
+	for _, retry := range retries {
+		retriedKeys[savedObjectKey(retry.Type, retry.ID)] = true
+	}
+
+	objectErrors := make([]savedObjectError, 0, len(result.Errors))
+	for _, objectError := range result.Errors {
+		if !retriedKeys[savedObjectKey(objectError.Type, objectError.ID)] {
+			objectErrors = append(objectErrors, objectError)
+		}
+	}
+	objectErrors = append(objectErrors, retryResult.Errors...)
+
+	return &savedObjectImportResponse{
+		Success:        len(objectErrors) == 0,
+		SuccessCount:   result.SuccessCount + retryResult.SuccessCount,
+		SuccessResults: append(result.SuccessResults, retryResult.SuccessResults...),
+		Errors:         objectErrors,
+	}
+}
+
+// flattenCopyStatus convert the result of copy to status, sorted by space
+// The previous status is kept for target spaces where objects are not copied again, and destination ids are merged with the previous ones
+func flattenCopyStatus(targetSpaces []string, results map[string]*savedObjectImportResponse, previousStatus []interface{}) []interface{} {
+	previousSpaces := map[string]interface{}{}
+	for _, raw := range previousStatus {
+		previousSpaces[raw.(map[string]interface{})["space"].(string)] = raw
+	}
+
+	spaces := make([]string, len(targetSpaces))
+	copy(spaces, targetSpaces)
+	sort.Strings(spaces)
+
+	status := make([]interface{}, 0, len(spaces))
+	for _, space := range spaces {
+		result, ok := results[space]
+		if !ok || result == nil {
+			if previous, ok := previousSpaces[space]; ok {
+				status = append(status, previous)
+			}
+			continue
+		}
+
+		messages := make([]interface{}, 0, len(result.Errors))
+		if !result.Success {
+			for _, objectError := range diagFromSavedObjectErrors("copy", space, result.Errors) {
+				if objectError.Detail != "" {
+					messages = append(messages, fmt.Sprintf("%s: %s", objectError.Summary, objectError.Detail))
+				} else {
+					messages = append(messages, objectError.Summary)
+				}
+			}
+		}
+
+		// Objects copied before are still in space when they conflict now, so their destination ids are kept
+		destinationIDs := map[string]interface{}{}
+		if previous, ok := previousSpaces[space]; ok {
+			if previousDestinationIDs, ok := previous.(map[string]interface{})["destination_ids"].(map[string]interface{}); ok {
+				for key, destinationID := range previousDestinationIDs {
+					destinationIDs[key] = destinationID
+				}
+			}
+		}
+		for _, success := range result.SuccessResults {
+			destinationID := success.DestinationID
+			if destinationID == "" {
+				destinationID = success.ID
+			}
+			destinationIDs[savedObjectKey(success.Type, success.ID)] = destinationID
+		}
+
+		status = append(status, map[string]interface{}{
+			"space":           space,
+			"success":         result.Success,
+			"success_count":   result.SuccessCount,
+			"errors":          messages,
+			"destination_ids": destinationIDs,
+			"synced":          result.Success,
+		})
+	}
+
+	return status
+}
+
+// flattenSyncedStatus set on status if objects are synced with source space in each target space
+// Target spaces without status, like after import, get a status with the sync state and the objects found in space
+func flattenSyncedStatus(previousStatus []interface{}, syncedSpaces map[string]bool, foundDestinationIDs map[string]map[string]interface{}) []interface{} {
+	status := make([]interface{}, 0, len(syncedSpaces))
+	hasStatus := map[string]bool{}
+	for _, raw := range previousStatus {
+		m := raw.(map[string]interface{})
+		synced, ok := syncedSpaces[m["space"].(string)]
+		if !ok {
+			continue
+		}
+		spaceStatus := make(map[string]interface{}, len(m))
+		for key, value := range m {
+			spaceStatus[key] = value
+		}
+		spaceStatus["synced"] = synced
+		status = append(status, spaceStatus)
+		hasStatus[m["space"].(string)] = true
+	}
+
+	for space, synced := range syncedSpaces {
+		if hasStatus[space] {
+			continue
+		}
+		destinationIDs, ok := foundDestinationIDs[space]
+		if !ok {
+			destinationIDs = map[string]interface{}{}
+		}
+		status = append(status, map[string]interface{}{
+			"space":           space,
+			"success":         synced,
+			"success_count":   0,
+			"errors":          []interface{}{},
+			"destination_ids": destinationIDs,
+			"synced":          synced,
+		})
+	}
+
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].(map[string]interface{})["space"].(string) < status[j].(map[string]interface{})["space"].(string)
+	})
+
+	return status
+}
+
+// unsyncedSpaces return the target spaces where objects are not synced with source space, from status
+func unsyncedSpaces(status []interface{}, targetSpaces *schema.Set) []string {
+	spaces := make([]string, 0)
+	for _, raw := range status {
+		m := raw.(map[string]interface{})
+		if synced, _ := m["synced"].(bool); !synced && targetSpaces.Contains(m["space"].(string)) {
+			spaces = append(spaces, m["space"].(string))
+		}
+	}
+
+	return spaces
 }
@@ -1,11 +1,16 @@
 package kb
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"strings"
 	"testing"
 
-	"github.com/hashicorp/terraform-plugin-sdk/helper/resource"
-	"github.com/hashicorp/terraform-plugin-sdk/terraform"
+	"github.com/ggsood/go-kibana-rest/v7/kbapi"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
@@ -26,6 +31,14 @@ func TestAccKibanaCopyObject(t *testing.T) {
 				),
 				ExpectNonEmptyPlan: true,
 			},
+			{
+				ResourceName:      "kibana_copy_object.test",
+				ImportState:       true,
+				ImportStateId:     "default/terraform-test2/index-pattern:test",
+				ImportStateVerify: true,
+				// The name and the status of copy are not part of import ID
+				ImportStateVerifyIgnore: []string{"name", "status"},
+			},
 		},
 	})
 }
@@ -47,7 +60,7 @@ func testCheckKibanaCopyObjectExists(name string) resource.TestCheckFunc {
 
 		meta := testAccProvider.Meta()
 
-		client, err := getClient(meta.(*ProviderConf))
+		client, err := getClient(context.Background(), meta.(*ProviderConf))
 		if err != nil {
 			return err
 		}
@@ -58,7 +71,6 @@ func testCheckKibanaCopyObjectExists(name string) resource.TestCheckFunc {
 		}
 
 		if len(data) == 0 {
-			panic(fmt.Sprintf("%+v", data))
 			return errors.Errorf("Object %s not found", rs.Primary.ID)
 		}
 
@@ -104,3 +116,600 @@ resource kibana_copy_object "test" {
   depends_on = [kibana_object.test, kibana_user_space.test]
 }
 `
+
+func TestKibanaCopyObjectLifecycle(t *testing.T) {
+	for _, version := range testKibanaVersions {
+		t.Run(version, func(t *testing.T) {
+			testKibanaCopyObjectLifecycle(t, version)
+		})
+	}
+}
+
+func testKibanaCopyObjectLifecycle(t *testing.T, version string) {
+	fake := newFakeKibana(t, version)
+	meta := fake.conf()
+	ctx := context.Background()
+	r := resourceKibanaCopyObject()
+
+	fake.spaces["target"] = &kbapi.KibanaSpace{ID: "target", Name: "target"}
+	fake.addObject("default", map[string]interface{}{
+		"id":         "test",
+		"type":       "index-pattern",
+		"attributes": map[string]interface{}{"title": "test"},
+	})
+	fake.addObject("default", map[string]interface{}{
+		"id":         "test",
+		"type":       "dashboard",
+		"attributes": map[string]interface{}{"title": "test"},
+		"references": []interface{}{
+			map[string]interface{}{"id": "test", "name": "panel_0", "type": "index-pattern"},
+		},
+	})
+
+	config := map[string]interface{}{
+		"name":          "test",
+		"target_spaces": []interface{}{"target"},
+		"object": []interface{}{
+			map[string]interface{}{
+				"id":   "test",
+				"type": "dashboard",
+			},
+		},
+	}
+	d := schema.TestResourceDataRaw(t, r.Schema, config)
+
+	// Create
+	// Kibana 8 copy objects with another id
+	testCheckDiags(t, r.CreateContext(ctx, d, meta))
+	copiedID := d.Get("status.0.destination_ids").(map[string]interface{})["index-pattern/test"].(string)
+	if d.Id() != "test" || fake.getObject("target", "index-pattern", copiedID) == nil {
+		t.Fatal("Object must be copied")
+	}
+	if !d.Get("status.0.synced").(bool) {
+		t.Fatal("Target space must be in sync")
+	}
+
+	// Copies settle, even with another id
+	d = r.Data(d.State())
+	testCheckDiags(t, r.ReadContext(ctx, d, meta))
+	diff, err := r.Diff(ctx, d.State(), terraform.NewResourceConfigRaw(config), meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Get("status.0.synced").(bool) || (diff != nil && !diff.Empty()) {
+		t.Fatalf("Copies must not drift, got %+v", diff)
+	}
+
+	// Rename is an update that not copy objects again
+	config["name"] = "renamed"
+	diff, err = r.Diff(ctx, d.State(), terraform.NewResourceConfigRaw(config), meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.RequiresNew() {
+		t.Fatal("Rename must not replace copies")
+	}
+	d = testResourceDataUpdate(t, r, d.State(), config, meta)
+	nbRequests := len(fake.requests)
+	testCheckDiags(t, r.UpdateContext(ctx, d, meta))
+	for _, request := range fake.requests[nbRequests:] {
+		if strings.Contains(request, "_copy_saved_objects") || strings.HasPrefix(request, http.MethodDelete) {
+			t.Fatalf("Objects must not be copied or deleted on rename, got %s", request)
+		}
+	}
+	if d.Id() != "test" || d.Get("name").(string) != "renamed" {
+		t.Fatalf("Rename must keep the resource ID, got %s", d.Id())
+	}
+
+	// Drift when object is changed in target space
+	fake.addObject("target", map[string]interface{}{
+		"id":         copiedID,
+		"type":       "index-pattern",
+		"attributes": map[string]interface{}{"title": "updated"},
+	})
+	d = r.Data(d.State())
+	testCheckDiags(t, r.ReadContext(ctx, d, meta))
+	if d.Get("target_spaces").(*schema.Set).Len() != 1 || d.Get("status.0.synced").(bool) {
+		t.Fatalf("Target space with different object must be kept as configured and not synced, got %+v", d.State())
+	}
+	diff, err = r.Diff(ctx, d.State(), terraform.NewResourceConfigRaw(config), meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff == nil || diff.Attributes["target_spaces.#"] != nil || diff.Attributes["status.#"] == nil || !diff.Attributes["status.#"].NewComputed {
+		t.Fatalf("Only status must be planned to copy again objects, got %+v", diff)
+	}
+
+	// Objects are copied again in target space not synced
+	d = testResourceDataUpdate(t, r, d.State(), config, meta)
+	testCheckDiags(t, r.UpdateContext(ctx, d, meta))
+	if fake.getObject("target", "index-pattern", copiedID)["attributes"].(map[string]interface{})["title"] != "test" || !d.Get("status.0.synced").(bool) {
+		t.Fatal("Object must be copied again in target space")
+	}
+
+	// Object is not copied again without overwrite
+	fake.addObject("target", map[string]interface{}{
+		"id":         copiedID,
+		"type":       "index-pattern",
+		"attributes": map[string]interface{}{"title": "updated"},
+	})
+	d.Set("overwrite", false)
+	testCheckDiags(t, r.ReadContext(ctx, d, meta))
+	if !d.Get("status.0.synced").(bool) {
+		t.Fatal("Target space must be synced without overwrite")
+	}
+	d.Set("overwrite", true)
+
+	// Drift when object is deleted in target space
+	fake.deleteObject("target", "index-pattern", copiedID)
+	testCheckDiags(t, r.ReadContext(ctx, d, meta))
+	if d.Get("target_spaces").(*schema.Set).Len() != 1 || d.Get("status.0.synced").(bool) {
+		t.Fatal("Target space without object must not be synced")
+	}
+
+	// Copy on space that not exist
+	d.Set("target_spaces", []interface{}{"target", "missing"})
+	testCheckDiagsError(t, r.UpdateContext(ctx, d, meta), "missing")
+}
+
+func TestKibanaCopyObjectImport(t *testing.T) {
+	fake := newFakeKibana(t, "7.10.2")
+	meta := fake.conf()
+	ctx := context.Background()
+	r := resourceKibanaCopyObject()
+
+	d := r.Data(nil)
+	d.SetId("default/target1,target2/index-pattern:test,dashboard:test")
+	states, err := r.Importer.StateContext(ctx, d, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d = states[0]
+	if d.Get("source_space").(string) != "default" || d.Get("target_spaces").(*schema.Set).Len() != 2 || d.Get("object").(*schema.Set).Len() != 2 {
+		t.Fatalf("Source space, target spaces and objects must be set, got %+v", d.State())
+	}
+
+	// Imported copy has no diff with configuration
+	fake.spaces["target"] = &kbapi.KibanaSpace{ID: "target", Name: "target"}
+	fake.addObject("default", map[string]interface{}{
+		"id":         "test",
+		"type":       "index-pattern",
+		"attributes": map[string]interface{}{"title": "test"},
+	})
+	raw := map[string]interface{}{
+		"name":          "test",
+		"target_spaces": []interface{}{"target"},
+		"object": []interface{}{
+			map[string]interface{}{
+				"id":   "test",
+				"type": "index-pattern",
+			},
+		},
+	}
+	d = schema.TestResourceDataRaw(t, r.Schema, raw)
+	testCheckDiags(t, r.CreateContext(ctx, d, meta))
+
+	d = r.Data(nil)
+	d.SetId("default/target/index-pattern:test")
+	if states, err = r.Importer.StateContext(ctx, d, meta); err != nil {
+		t.Fatal(err)
+	}
+	d = states[0]
+	testCheckDiags(t, r.ReadContext(ctx, d, meta))
+	diff, err := r.Diff(ctx, d.State(), terraform.NewResourceConfigRaw(raw), meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff != nil && !diff.Empty() {
+		t.Fatalf("Imported copy must not drift, got %+v", diff)
+	}
+
+	// Imported copy is deleted on destroy
+	testCheckDiags(t, r.DeleteContext(ctx, d, meta))
+	if fake.getObject("target", "index-pattern", "test") != nil {
+		t.Fatal("Imported copy must be deleted on destroy")
+	}
+
+	// Invalid import ID
+	d = r.Data(nil)
+	d.SetId("default/index-pattern:test")
+	if _, err = r.Importer.StateContext(ctx, d, meta); err == nil {
+		t.Fatal("Import ID without target spaces must failed")
+	}
+}
+
+func TestKibanaCopyObjectDelete(t *testing.T) {
+	fake := newFakeKibana(t, "7.10.2")
+	meta := fake.conf()
+	ctx := context.Background()
+	r := resourceKibanaCopyObject()
+
+	fake.spaces["target1"] = &kbapi.KibanaSpace{ID: "target1", Name: "target1"}
+	fake.spaces["target2"] = &kbapi.KibanaSpace{ID: "target2", Name: "target2"}
+	fake.addObject("default", map[string]interface{}{
+		"id":         "ref",
+		"type":       "index-pattern",
+		"attributes": map[string]interface{}{"title": "ref"},
+	})
+	fake.addObject("default", map[string]interface{}{
+		"id":         "test",
+		"type":       "visualization",
+		"attributes": map[string]interface{}{"title": "test"},
+		"references": []interface{}{
+			map[string]interface{}{"name": "index", "type": "index-pattern", "id": "ref"},
+		},
+	})
+
+	config := map[string]interface{}{
+		"name":          "test",
+		"target_spaces": []interface{}{"target1", "target2"},
+		"object": []interface{}{
+			map[string]interface{}{
+				"id":   "test",
+				"type": "visualization",
+			},
+		},
+	}
+	d := schema.TestResourceDataRaw(t, r.Schema, config)
+	testCheckDiags(t, r.CreateContext(ctx, d, meta))
+
+	// Remove target space
+	config["target_spaces"] = []interface{}{"target1"}
+	d = testResourceDataUpdate(t, r, d.State(), config, meta)
+	testCheckDiags(t, r.UpdateContext(ctx, d, meta))
+	if fake.getObject("target2", "visualization", "test") != nil {
+		t.Fatal("Copied object must be deleted from removed target space")
+	}
+	if fake.getObject("target2", "index-pattern", "ref") == nil {
+		t.Fatal("Copied reference must be kept without delete_references")
+	}
+	if fake.getObject("target1", "visualization", "test") == nil {
+		t.Fatal("Copied object must be kept in target space")
+	}
+
+	// Destroy with references
+	d.Set("delete_references", true)
+	testCheckDiags(t, r.DeleteContext(ctx, d, meta))
+	if d.Id() != "" || fake.getObject("target1", "visualization", "test") != nil || fake.getObject("target1", "index-pattern", "ref") != nil {
+		t.Fatal("Copied object and references must be deleted")
+	}
+	if fake.getObject("default", "visualization", "test") == nil || fake.getObject("default", "index-pattern", "ref") == nil {
+		t.Fatal("Source objects must be kept")
+	}
+
+	// Destroy when target space not exist anymore
+	d.SetId("test")
+	delete(fake.spaces, "target1")
+	testCheckDiags(t, r.DeleteContext(ctx, d, meta))
+}
+
+func TestKibanaCopyObjectDeleteAfterSourceChange(t *testing.T) {
+	fake := newFakeKibana(t, "7.10.2")
+	meta := fake.conf()
+	ctx := context.Background()
+	r := resourceKibanaCopyObject()
+
+	fake.spaces["target1"] = &kbapi.KibanaSpace{ID: "target1", Name: "target1"}
+	fake.spaces["target2"] = &kbapi.KibanaSpace{ID: "target2", Name: "target2"}
+	fake.addObject("default", map[string]interface{}{
+		"id":         "test",
+		"type":       "index-pattern",
+		"attributes": map[string]interface{}{"title": "test"},
+	})
+	updateSource := func(title string) {
+		fake.addObject("default", map[string]interface{}{
+			"id":         "test",
+			"type":       "index-pattern",
+			"attributes": map[string]interface{}{"title": title},
+		})
+	}
+
+	config := map[string]interface{}{
+		"name":          "test",
+		"target_spaces": []interface{}{"target1", "target2"},
+		"object": []interface{}{
+			map[string]interface{}{
+				"id":   "test",
+				"type": "index-pattern",
+			},
+		},
+	}
+	d := schema.TestResourceDataRaw(t, r.Schema, config)
+	testCheckDiags(t, r.CreateContext(ctx, d, meta))
+
+	// Remove target space that drift
+	updateSource("updated")
+	d = r.Data(d.State())
+	testCheckDiags(t, r.ReadContext(ctx, d, meta))
+	config["target_spaces"] = []interface{}{"target1"}
+	d = testResourceDataUpdate(t, r, d.State(), config, meta)
+	testCheckDiags(t, r.UpdateContext(ctx, d, meta))
+	if fake.getObject("target2", "index-pattern", "test") != nil {
+		t.Fatal("Copied object must be deleted from removed target space, even if it drift")
+	}
+	if fake.getObject("target1", "index-pattern", "test") == nil {
+		t.Fatal("Copied object must be kept in target space")
+	}
+
+	// Destroy after source change
+	updateSource("updated again")
+	d = r.Data(d.State())
+	testCheckDiags(t, r.ReadContext(ctx, d, meta))
+	testCheckDiags(t, r.DeleteContext(ctx, d, meta))
+	if fake.getObject("target1", "index-pattern", "test") != nil {
+		t.Fatal("Copied object must be deleted on destroy, even if it drift")
+	}
+
+	// Destroy state where drifted target spaces were removed by previous version
+	config["target_spaces"] = []interface{}{"target1", "target2"}
+	d = schema.TestResourceDataRaw(t, r.Schema, config)
+	testCheckDiags(t, r.CreateContext(ctx, d, meta))
+	d.Set("target_spaces", []interface{}{})
+	testCheckDiags(t, r.DeleteContext(ctx, d, meta))
+	if fake.getObject("target1", "index-pattern", "test") != nil || fake.getObject("target2", "index-pattern", "test") != nil {
+		t.Fatal("Copied objects must be deleted from spaces on status")
+	}
+}
+
+func TestKibanaCopyObjectDeleteAfterConflict(t *testing.T) {
+	fake := newFakeKibana(t, "7.10.2")
+	meta := fake.conf()
+	ctx := context.Background()
+	r := resourceKibanaCopyObject()
+
+	fake.spaces["target1"] = &kbapi.KibanaSpace{ID: "target1", Name: "target1"}
+	fake.spaces["target2"] = &kbapi.KibanaSpace{ID: "target2", Name: "target2"}
+	fake.addObject("default", map[string]interface{}{
+		"id":         "test",
+		"type":       "index-pattern",
+		"attributes": map[string]interface{}{"title": "test"},
+	})
+	fake.addObject("target2", map[string]interface{}{
+		"id":         "test",
+		"type":       "index-pattern",
+		"attributes": map[string]interface{}{"title": "hand made"},
+	})
+
+	config := map[string]interface{}{
+		"name":          "test",
+		"target_spaces": []interface{}{"target1", "target2"},
+		"overwrite":     false,
+		"object": []interface{}{
+			map[string]interface{}{
+				"id":   "test",
+				"type": "index-pattern",
+			},
+		},
+	}
+	d := schema.TestResourceDataRaw(t, r.Schema, config)
+	testCheckDiagsError(t, r.CreateContext(ctx, d, meta), "conflict")
+	if d.Id() == "" {
+		t.Fatal("Resource must be created when objects are copied in some spaces")
+	}
+
+	// Objects not copied because of conflict must be kept on destroy
+	testCheckDiags(t, r.DeleteContext(ctx, d, meta))
+	if fake.getObject("target1", "index-pattern", "test") != nil {
+		t.Fatal("Copied object must be deleted on destroy")
+	}
+	object := fake.getObject("target2", "index-pattern", "test")
+	if object == nil || object["attributes"].(map[string]interface{})["title"] != "hand made" {
+		t.Fatal("Object in conflict must not be deleted on destroy")
+	}
+
+	// Same when the space is removed from target spaces
+	d = schema.TestResourceDataRaw(t, r.Schema, config)
+	testCheckDiagsError(t, r.CreateContext(ctx, d, meta), "conflict")
+	config["target_spaces"] = []interface{}{"target1"}
+	config["overwrite"] = true
+	d = testResourceDataUpdate(t, r, d.State(), config, meta)
+	testCheckDiags(t, r.UpdateContext(ctx, d, meta))
+	object = fake.getObject("target2", "index-pattern", "test")
+	if object == nil || object["attributes"].(map[string]interface{})["title"] != "hand made" {
+		t.Fatal("Object in conflict must not be deleted when space is removed from target spaces")
+	}
+	if fake.getObject("target1", "index-pattern", "test") == nil {
+		t.Fatal("Copied object must be kept in target space")
+	}
+}
+
+func TestKibanaCopyObjectStatus(t *testing.T) {
+	fake := newFakeKibana(t, "7.10.2")
+	meta := fake.conf()
+	ctx := context.Background()
+	r := resourceKibanaCopyObject()
+
+	fake.spaces["target1"] = &kbapi.KibanaSpace{ID: "target1", Name: "target1"}
+	fake.spaces["target2"] = &kbapi.KibanaSpace{ID: "target2", Name: "target2"}
+	fake.addObject("default", map[string]interface{}{
+		"id":         "test",
+		"type":       "index-pattern",
+		"attributes": map[string]interface{}{"title": "test"},
+	})
+	fake.addObject("target2", map[string]interface{}{
+		"id":         "test",
+		"type":       "index-pattern",
+		"attributes": map[string]interface{}{"title": "existing"},
+	})
+
+	config := map[string]interface{}{
+		"name":          "test",
+		"target_spaces": []interface{}{"target2", "target1"},
+		"overwrite":     false,
+		"object": []interface{}{
+			map[string]interface{}{
+				"id":   "test",
+				"type": "index-pattern",
+			},
+		},
+	}
+
+	// Copy failed in one space
+	d := schema.TestResourceDataRaw(t, r.Schema, config)
+	testCheckDiagsError(t, r.CreateContext(ctx, d, meta), "Failed to copy index-pattern test in space target2")
+	if d.Id() != "test" {
+		t.Fatal("Resource must be kept when objects are copied in some spaces")
+	}
+	if d.Get("status.#").(int) != 2 || d.Get("status.0.space").(string) != "target1" || !d.Get("status.0.success").(bool) || d.Get("status.0.success_count").(int) != 1 {
+		t.Fatalf("Copy in space target1 must be successful, got %+v", d.Get("status"))
+	}
+	if d.Get("status.1.space").(string) != "target2" || d.Get("status.1.success").(bool) || d.Get("status.1.errors.#").(int) != 1 {
+		t.Fatalf("Copy in space target2 must failed, got %+v", d.Get("status"))
+	}
+
+	// Conflict is resolved with overwrite
+	config["overwrite_objects"] = []interface{}{
+		map[string]interface{}{
+			"id":   "test",
+			"type": "index-pattern",
+		},
+	}
+	d = testResourceDataUpdate(t, r, d.State(), config, meta)
+	testCheckDiags(t, r.UpdateContext(ctx, d, meta))
+	if fake.getObject("target2", "index-pattern", "test")["attributes"].(map[string]interface{})["title"] != "test" {
+		t.Fatal("Object in conflict must be overwritten")
+	}
+	if !d.Get("status.1.success").(bool) || d.Get("status.1.success_count").(int) != 1 || d.Get("status.1.errors.#").(int) != 0 {
+		t.Fatalf("Copy in space target2 must be successful once resolved, got %+v", d.Get("status"))
+	}
+}
+
+func TestKibanaCopyObjectCreateNewCopies(t *testing.T) {
+	fake := newFakeKibana(t, "7.10.2")
+	meta := fake.conf()
+	ctx := context.Background()
+	r := resourceKibanaCopyObject()
+
+	fake.spaces["target1"] = &kbapi.KibanaSpace{ID: "target1", Name: "target1"}
+	fake.spaces["target2"] = &kbapi.KibanaSpace{ID: "target2", Name: "target2"}
+	fake.addObject("default", map[string]interface{}{
+		"id":         "ref",
+		"type":       "index-pattern",
+		"attributes": map[string]interface{}{"title": "ref"},
+	})
+	fake.addObject("default", map[string]interface{}{
+		"id":         "test",
+		"type":       "visualization",
+		"attributes": map[string]interface{}{"title": "test"},
+		"references": []interface{}{
+			map[string]interface{}{"name": "index", "type": "index-pattern", "id": "ref"},
+		},
+	})
+
+	config := map[string]interface{}{
+		"name":              "test",
+		"target_spaces":     []interface{}{"target1"},
+		"create_new_copies": true,
+		"object": []interface{}{
+			map[string]interface{}{
+				"id":   "test",
+				"type": "visualization",
+			},
+		},
+	}
+
+	// Create
+	d := schema.TestResourceDataRaw(t, r.Schema, config)
+	testCheckDiags(t, r.CreateContext(ctx, d, meta))
+	destinationID := d.Get("status.0.destination_ids").(map[string]interface{})["visualization/test"].(string)
+	referenceID := d.Get("status.0.destination_ids").(map[string]interface{})["index-pattern/ref"].(string)
+	if destinationID == "" || destinationID == "test" || referenceID == "" || referenceID == "ref" {
+		t.Fatalf("Objects must be copied with new id, got %+v", d.Get("status"))
+	}
+	copied := fake.getObject("target1", "visualization", destinationID)
+	if copied == nil || copied["references"].([]interface{})[0].(map[string]interface{})["id"] != referenceID {
+		t.Fatal("Copy must reference the copy of index pattern")
+	}
+	if d.Get("target_spaces").(*schema.Set).Len() != 1 {
+		t.Fatal("Target space with copies must be in sync")
+	}
+
+	// Objects are only copied in new target space
+	config["target_spaces"] = []interface{}{"target1", "target2"}
+	d = testResourceDataUpdate(t, r, d.State(), config, meta)
+	testCheckDiags(t, r.UpdateContext(ctx, d, meta))
+	if len(fake.spaceObjects("target1")) != 2 || len(fake.spaceObjects("target2")) != 2 {
+		t.Fatalf("Objects must be copied once in each space, got %+v and %+v", fake.spaceObjects("target1"), fake.spaceObjects("target2"))
+	}
+	if d.Get("status.#").(int) != 2 || d.Get("status.0.destination_ids").(map[string]interface{})["visualization/test"] != destinationID {
+		t.Fatalf("Status of target1 must be kept, got %+v", d.Get("status"))
+	}
+
+	// Drift when copy is deleted
+	fake.deleteObject("target1", "visualization", destinationID)
+	d = r.Data(d.State())
+	testCheckDiags(t, r.ReadContext(ctx, d, meta))
+	if d.Get("target_spaces").(*schema.Set).Len() != 2 || d.Get("status.0.synced").(bool) || !d.Get("status.1.synced").(bool) {
+		t.Fatalf("Target space without copy must not be synced, got %+v", d.Get("status"))
+	}
+
+	// Copies are only created again in target space without copy
+	d = testResourceDataUpdate(t, r, d.State(), config, meta)
+	testCheckDiags(t, r.UpdateContext(ctx, d, meta))
+	if len(fake.spaceObjects("target2")) != 2 || !d.Get("status.0.synced").(bool) {
+		t.Fatalf("Objects must be copied again only in target1, got %+v", d.Get("status"))
+	}
+	newDestinationID := d.Get("status.0.destination_ids").(map[string]interface{})["visualization/test"].(string)
+	if newDestinationID == destinationID || fake.getObject("target1", "visualization", newDestinationID) == nil {
+		t.Fatalf("New copy must be created in target1, got %+v", d.Get("status"))
+	}
+
+	// Copies are deleted on destroy
+	destinationID = d.Get("status.1.destination_ids").(map[string]interface{})["visualization/test"].(string)
+	testCheckDiags(t, r.DeleteContext(ctx, d, meta))
+	if fake.getObject("target2", "visualization", destinationID) != nil {
+		t.Fatal("Copy must be deleted")
+	}
+
+	// Changed objects are copied again
+	diff, err := r.Diff(ctx, d.State(), terraform.NewResourceConfigRaw(map[string]interface{}{
+		"name":              "test",
+		"target_spaces":     []interface{}{"target2"},
+		"create_new_copies": true,
+		"object": []interface{}{
+			map[string]interface{}{
+				"id":   "ref",
+				"type": "index-pattern",
+			},
+		},
+	}), meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !diff.RequiresNew() {
+		t.Fatal("Objects must be copied again when they change with create_new_copies")
+	}
+
+	// Create new copies need Kibana 7.10
+	fake.version = "7.9.3"
+	if _, err = r.Diff(ctx, nil, terraform.NewResourceConfigRaw(config), fake.conf()); err == nil {
+		t.Fatal("create_new_copies must failed with Kibana 7.9")
+	}
+}
+
+func TestHashCopiedObjects(t *testing.T) {
+	sourceHashes, err := hashSavedObjects(`{"id":"test","type":"dashboard","attributes":{"title":"test"},"references":[{"id":"ref","name":"panel_0","type":"index-pattern"}]}
+{"id":"ref","type":"index-pattern","attributes":{"title":"ref"}}`, copyIgnoredFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetHashes, err := hashCopiedObjects(`{"id":"test-target","type":"dashboard","attributes":{"title":"test"},"references":[{"id":"ref-target","name":"panel_0","type":"index-pattern"}],"originId":"test"}
+{"id":"ref-target","type":"index-pattern","attributes":{"title":"ref"},"originId":"ref"}`, map[string]string{
+		"dashboard/test":    "test-target",
+		"index-pattern/ref": "ref-target",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isCopySynced(sourceHashes, targetHashes, true) {
+		t.Fatalf("Copies with other id must be compared by source id, got %+v and %+v", sourceHashes, targetHashes)
+	}
+
+	// Objects without destination id keep their id
+	if targetHashes, err = hashCopiedObjects(`{"id":"ref","type":"index-pattern","attributes":{"title":"ref"}}`, nil); err != nil {
+		t.Fatal(err)
+	}
+	if targetHashes["index-pattern/ref"] != sourceHashes["index-pattern/ref"] {
+		t.Fatalf("Copies with same id must have the same hash, got %+v", targetHashes)
+	}
+}
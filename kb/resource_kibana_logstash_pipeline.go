@@ -1,29 +1,40 @@
 // Manage the logstash pipeline in Kibana
 // API documentation: https://www.elastic.co/guide/en/kibana/master/logstash-configuration-management-api.html
 // Supported version:
-//  - v7
+//  - v7 (removed from Kibana 8)
 
 package kb
 
 import (
-	"fmt"
+	"context"
+	"time"
 
 	kbapi "github.com/ggsood/go-kibana-rest/v7/kbapi"
 
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	log "github.com/sirupsen/logrus"
 )
 
 // Resource specification to handle logstash pipeline in Kibana
 func resourceKibanaLogstashPipeline() *schema.Resource {
 	return &schema.Resource{
-		Create: resourceKibanaLogstashPipelineCreate,
-		Read:   resourceKibanaLogstashPipelineRead,
-		Update: resourceKibanaLogstashPipelineUpdate,
-		Delete: resourceKibanaLogstashPipelineDelete,
+		CreateContext: resourceKibanaLogstashPipelineCreate,
+		ReadContext:   resourceKibanaLogstashPipelineRead,
+		UpdateContext: resourceKibanaLogstashPipelineUpdate,
+		DeleteContext: resourceKibanaLogstashPipelineDelete,
+
+		CustomizeDiff: checkKibanaCapabilities("kibana_logstash_pipeline"),
 
 		Importer: &schema.ResourceImporter{
-			State: schema.ImportStatePassthrough,
+			StateContext: schema.ImportStatePassthroughContext,
+		},
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Read:   schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
 		},
 
 		Schema: map[string]*schema.Schema{
@@ -57,42 +68,41 @@ func resourceKibanaLogstashPipeline() *schema.Resource {
 }
 
 // Create new logstash pipeline in Kibana
-func resourceKibanaLogstashPipelineCreate(d *schema.ResourceData, meta interface{}) error {
+func resourceKibanaLogstashPipelineCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 
-	logstashPipeline, err := createOrUpdateLogstashPipeline(d, meta)
+	logstashPipeline, err := createOrUpdateLogstashPipeline(ctx, d, meta)
 	if err != nil {
-		return err
+		return diagFromKibanaError(err)
 	}
 
 	d.SetId(logstashPipeline.ID)
 
 	log.Infof("Created logstash pipeline %s successfully", logstashPipeline.ID)
 
-	return resourceKibanaLogstashPipelineRead(d, meta)
+	return resourceKibanaLogstashPipelineRead(ctx, d, meta)
 }
 
 // Read existing logstash pipeline in Kibana
-func resourceKibanaLogstashPipelineRead(d *schema.ResourceData, meta interface{}) error {
+func resourceKibanaLogstashPipelineRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 
 	id := d.Id()
 
 	log.Debugf("Logstash pipeline id:  %s", id)
 
-	client, err := getClient(meta.(*ProviderConf))
+	client, err := getClient(ctx, meta.(*ProviderConf))
 	if err != nil {
-		return err
+		return diagFromKibanaError(err)
 	}
 
 	logstashPiepeline, err := client.API.KibanaLogstashPipeline.Get(id)
 	if err != nil {
-		return err
+		return diagFromKibanaError(err)
 	}
 
 	if logstashPiepeline == nil {
-		fmt.Printf("[WARN] Logstash pipeline %s not found - removing from state", id)
 		log.Warnf("Logstash piepline %s not found - removing from state", id)
 		d.SetId("")
-		return nil
+		return diagWarning("Logstash pipeline %s not found - removing from state", id)
 	}
 
 	log.Debugf("Get logstash piepeline %s successfully:\n%s", id, logstashPiepeline)
@@ -109,38 +119,37 @@ func resourceKibanaLogstashPipelineRead(d *schema.ResourceData, meta interface{}
 }
 
 // Update existing logstash pipeline in Elasticsearch
-func resourceKibanaLogstashPipelineUpdate(d *schema.ResourceData, meta interface{}) error {
+func resourceKibanaLogstashPipelineUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 
-	logstashPipeline, err := createOrUpdateLogstashPipeline(d, meta)
+	logstashPipeline, err := createOrUpdateLogstashPipeline(ctx, d, meta)
 	if err != nil {
-		return err
+		return diagFromKibanaError(err)
 	}
 
 	log.Infof("Updated logstash piepeline %s successfully", logstashPipeline.ID)
 
-	return resourceKibanaLogstashPipelineRead(d, meta)
+	return resourceKibanaLogstashPipelineRead(ctx, d, meta)
 }
 
 // Delete existing logstash pipeline in Elasticsearch
-func resourceKibanaLogstashPipelineDelete(d *schema.ResourceData, meta interface{}) error {
+func resourceKibanaLogstashPipelineDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 
 	id := d.Id()
 	log.Debugf("Logstash pipeline id: %s", id)
 
-	client, err := getClient(meta.(*ProviderConf))
+	client, err := getClient(ctx, meta.(*ProviderConf))
 	if err != nil {
-		return err
+		return diagFromKibanaError(err)
 	}
 
 	err = client.API.KibanaLogstashPipeline.Delete(id)
 	if err != nil {
-		if err.(kbapi.APIError).Code == 404 {
-			fmt.Printf("[WARN] Logstash pipeline %s not found - removing from state", id)
+		if isNotFoundError(err) {
 			log.Warnf("Logstash pipeline %s not found - removing from state", id)
 			d.SetId("")
-			return nil
+			return diagWarning("Logstash pipeline %s not found - removing from state", id)
 		}
-		return err
+		return diagFromKibanaError(err)
 
 	}
 
@@ -152,13 +161,13 @@ func resourceKibanaLogstashPipelineDelete(d *schema.ResourceData, meta interface
 }
 
 // createOrUpdateLogstashPipeline permit to create or update logstash pipeline
-func createOrUpdateLogstashPipeline(d *schema.ResourceData, meta interface{}) (*kbapi.LogstashPipeline, error) {
+func createOrUpdateLogstashPipeline(ctx context.Context, d *schema.ResourceData, meta interface{}) (*kbapi.LogstashPipeline, error) {
 	name := d.Get("name").(string)
 	description := d.Get("description").(string)
 	pipeline := d.Get("pipeline").(string)
 	settings := d.Get("settings").(map[string]interface{})
 
-	client, err := getClient(meta.(*ProviderConf))
+	client, err := getClient(ctx, meta.(*ProviderConf))
 	if err != nil {
 		return nil, err
 	}
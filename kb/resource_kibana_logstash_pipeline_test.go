@@ -1,11 +1,14 @@
 package kb
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"testing"
 
-	"github.com/hashicorp/terraform-plugin-sdk/helper/resource"
-	"github.com/hashicorp/terraform-plugin-sdk/terraform"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 	"github.com/pkg/errors"
 )
 
@@ -14,6 +17,7 @@ func TestAccKibanaLogstashPipeline(t *testing.T) {
 	resource.Test(t, resource.TestCase{
 		PreCheck: func() {
 			testAccPreCheck(t)
+			testAccPreCheckKibanaCapabilities(t, "kibana_logstash_pipeline")
 		},
 		Providers:    testAccProviders,
 		CheckDestroy: testCheckKibanaLogstashPipelineDestroy,
@@ -46,7 +50,7 @@ func testCheckKibanaLogstashPipelineExists(name string) resource.TestCheckFunc {
 
 		meta := testAccProvider.Meta()
 
-		client, err := getClient(meta.(*ProviderConf))
+		client, err := getClient(context.Background(), meta.(*ProviderConf))
 		if err != nil {
 			return err
 		}
@@ -71,7 +75,7 @@ func testCheckKibanaLogstashPipelineDestroy(s *terraform.State) error {
 
 		meta := testAccProvider.Meta()
 
-		client, err := getClient(meta.(*ProviderConf))
+		client, err := getClient(context.Background(), meta.(*ProviderConf))
 		if err != nil {
 			return err
 		}
@@ -100,3 +104,49 @@ resource "kibana_logstash_pipeline" "test" {
   }
 }
 `
+
+func TestKibanaLogstashPipelineLifecycle(t *testing.T) {
+	fake := newFakeKibana(t, "7.10.2")
+	meta := fake.conf()
+	ctx := context.Background()
+	r := resourceKibanaLogstashPipeline()
+
+	d := schema.TestResourceDataRaw(t, r.Schema, map[string]interface{}{
+		"name":        "test",
+		"description": "test",
+		"pipeline":    "input { stdin {} } output { stdout {} }",
+		"settings": map[string]interface{}{
+			"queue.type": "persisted",
+		},
+	})
+
+	// Create
+	testCheckDiags(t, r.CreateContext(ctx, d, meta))
+	if d.Id() != "test" || d.Get("username").(string) != "elastic" {
+		t.Fatal("Logstash pipeline must be created")
+	}
+
+	// Update
+	d.Set("description", "updated")
+	testCheckDiags(t, r.UpdateContext(ctx, d, meta))
+	if fake.pipelines["test"].Description != "updated" {
+		t.Fatal("Logstash pipeline must be updated")
+	}
+
+	// Kibana error
+	fake.failNext(http.MethodGet, "/api/logstash/pipeline/test", http.StatusForbidden, "missing privilege")
+	testCheckDiagsError(t, r.ReadContext(ctx, d, meta), "missing privilege")
+
+	// Delete
+	testCheckDiags(t, r.DeleteContext(ctx, d, meta))
+	if d.Id() != "" || fake.pipelines["test"] != nil {
+		t.Fatal("Logstash pipeline must be deleted")
+	}
+
+	// Drift when pipeline is deleted outside Terraform
+	d.SetId("test")
+	testCheckDiagsWarning(t, r.ReadContext(ctx, d, meta))
+	if d.Id() != "" {
+		t.Fatal("Logstash pipeline must be removed from state")
+	}
+}
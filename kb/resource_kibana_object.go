@@ -2,29 +2,53 @@
 // API documentation: https://www.elastic.co/guide/en/kibana/master/saved-objects-api.html
 // Supported version:
 //  - v7
+//  - v8
 
 package kb
 
 import (
-	"fmt"
-
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"context"
+	"strings"
+	"time"
+
+	kibana "github.com/ggsood/go-kibana-rest/v7"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
 // Resource specification to handle kibana save object
 func resourceKibanaObject() *schema.Resource {
 	return &schema.Resource{
-		Create: resourceKibanaObjectCreate,
-		Read:   resourceKibanaObjectRead,
-		Update: resourceKibanaObjectUpdate,
-		Delete: resourceKibanaObjectDelete,
+		CreateContext: resourceKibanaObjectCreate,
+		ReadContext:   resourceKibanaObjectRead,
+		UpdateContext: resourceKibanaObjectUpdate,
+		DeleteContext: resourceKibanaObjectDelete,
+
+		Importer: &schema.ResourceImporter{
+			StateContext: resourceKibanaObjectImport,
+		},
+
+		CustomizeDiff: customdiff.All(
+			checkKibanaCapabilities("kibana_object"),
+			customizeDiffKibanaObjects,
+		),
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Read:   schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
 
 		Schema: map[string]*schema.Schema{
 			"name": {
-				Type:     schema.TypeString,
-				Required: true,
-				ForceNew: true,
+				Type:             schema.TypeString,
+				Required:         true,
+				DiffSuppressFunc: suppressImportedName,
 			},
 			"space": {
 				Type:     schema.TypeString,
@@ -36,6 +60,8 @@ func resourceKibanaObject() *schema.Resource {
 				Type:             schema.TypeString,
 				Required:         true,
 				DiffSuppressFunc: suppressEquivalentNDJSON,
+				// The plan show the hash of each object for every resource, not only with store_data_hash
+				StateFunc: stateSavedObjectsHash,
 			},
 			"export_types": {
 				Type:     schema.TypeSet,
@@ -65,28 +91,99 @@ func resourceKibanaObject() *schema.Resource {
 				Optional: true,
 				Default:  true,
 			},
+			"conflict_resolution": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "overwrite",
+				ValidateFunc: validation.StringInSlice([]string{"overwrite", "skip"}, false),
+			},
+			"replace_references": {
+				Type:     schema.TypeSet,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"type": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"from": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"to": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+					},
+				},
+			},
+			"ignored_fields": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"store_data_hash": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"data_changes": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"delete_on_destroy": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  true,
+			},
+			"objects": {
+				Type:     schema.TypeSet,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"id": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"type": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
 		},
 	}
 }
 
 // Import objects in Kibana
-func resourceKibanaObjectCreate(d *schema.ResourceData, meta interface{}) error {
+func resourceKibanaObjectCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	name := d.Get("name").(string)
 
-	err := importObject(d, meta)
-	if err != nil {
-		return err
+	diags := importObject(ctx, d, meta)
+	if diags.HasError() {
+		// Some objects can be imported even if others failed, so keep track of them
+		if d.Get("objects").(*schema.Set).Len() > 0 {
+			d.SetId(name)
+		}
+		return diags
 	}
 
 	d.SetId(name)
 
 	log.Infof("Imported objects %s successfully", name)
 
-	return resourceKibanaObjectRead(d, meta)
+	return resourceKibanaObjectRead(ctx, d, meta)
 }
 
 // Export objects in Kibana
-func resourceKibanaObjectRead(d *schema.ResourceData, meta interface{}) error {
+// When export_types and export_objects are not set, it export the objects imported from data
+func resourceKibanaObjectRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 
 	id := d.Id()
 	exportTypes := convertArrayInterfaceToArrayString(d.Get("export_types").(*schema.Set).List())
@@ -99,58 +196,233 @@ func resourceKibanaObjectRead(d *schema.ResourceData, meta interface{}) error {
 	log.Debugf("Export Objects: %+v", exportObjects)
 	log.Debugf("Space: %s", space)
 
-	client, err := getClient(meta.(*ProviderConf))
+	client, err := getClient(ctx, meta.(*ProviderConf))
 	if err != nil {
-		return err
+		return diagFromKibanaError(err)
 	}
 
-	data, err := client.API.KibanaSavedObject.Export(exportTypes, exportObjects, deepReference, space)
+	var data []byte
+	if len(exportTypes) == 0 && len(exportObjects) == 0 {
+		objects := buildExportObjects(d.Get("objects").(*schema.Set).List())
+		if len(objects) == 0 {
+			log.Infof("Object %s not manage any object, nothing to export", id)
+			return nil
+		}
+		log.Debugf("Export imported objects: %+v", objects)
+		data, err = exportExistingObjects(client, objects, deepReference, space)
+	} else {
+		data, err = client.API.KibanaSavedObject.Export(exportTypes, exportObjects, deepReference, space)
+	}
 	if err != nil {
-		return err
+		return diagFromKibanaError(err)
 	}
 
 	if len(data) == 0 {
-		fmt.Printf("[WARN] Export object %s not found - removing from state", id)
 		log.Warnf("Export object %s not found - removing from state", id)
 		d.SetId("")
-		return nil
+		return diagWarning("Export object %s not found - removing from state", id)
 	}
 
 	log.Debugf("Export object %s successfully:\n%+v", id, string(data))
 
-	d.Set("name", id)
+	// Only keep the hash of each object to reduce the state size
+	if d.Get("store_data_hash").(bool) {
+		hashes, err := hashSavedObjects(string(data), ignoredFields(d))
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		data = []byte(formatSavedObjectsHash(hashes))
+	}
+
 	d.Set("data", string(data))
 	d.Set("space", space)
 	d.Set("export_types", exportTypes)
 	d.Set("export_objects", exportObjects)
 
+	// Changes are only relevant for the plan where data changed, so they are cleared on refresh
+	if !d.HasChange("data") {
+		d.Set("data_changes", []string{})
+	}
+
 	log.Infof("Export object %s successfully", id)
 
 	return nil
 }
 
+// exportExistingObjects permit to export objects, ignoring the objects that not exist anymore
+// Kibana failed to export when one object not exist, so each object is checked only in this case
+// It return empty data if no object exist
+func exportExistingObjects(client *kibana.Client, objects []map[string]string, deepReference bool, space string) ([]byte, error) {
+	data, exportErr := client.API.KibanaSavedObject.Export(nil, objects, deepReference, space)
+	if exportErr == nil || !isBadRequestError(exportErr) {
+		return data, exportErr
+	}
+
+	existingObjects := make([]map[string]string, 0, len(objects))
+	for _, object := range objects {
+		savedObject, err := client.API.KibanaSavedObject.Get(object["type"], object["id"], space)
+		if err != nil {
+			return nil, err
+		}
+		if savedObject == nil {
+			log.Warnf("Object %s/%s not found in space %s", object["type"], object["id"], space)
+			continue
+		}
+		existingObjects = append(existingObjects, object)
+	}
+	if len(existingObjects) == len(objects) {
+		return nil, exportErr
+	}
+	if len(existingObjects) == 0 {
+		return nil, nil
+	}
+
+	return client.API.KibanaSavedObject.Export(nil, existingObjects, deepReference, space)
+}
+
 // Update existing object in Kibana
-func resourceKibanaObjectUpdate(d *schema.ResourceData, meta interface{}) error {
+func resourceKibanaObjectUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	id := d.Id()
 
-	err := importObject(d, meta)
-	if err != nil {
-		return err
+	// Objects are only imported again when data change, state can only keep the hash of objects
+	if d.HasChange("data") {
+		diags := importObject(ctx, d, meta)
+		if diags.HasError() {
+			return diags
+		}
 	}
 
 	log.Infof("Updated object %s successfully", id)
 
-	return resourceKibanaObjectRead(d, meta)
+	return resourceKibanaObjectRead(ctx, d, meta)
+}
+
+// customizeDiffKibanaObjects permit to compute at plan time the objects imported from data
+// With skip conflict resolution, the objects are only known after apply
+// It also compute the readable list of objects that changed
+func customizeDiffKibanaObjects(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if !d.HasChange("data") && !d.HasChange("conflict_resolution") {
+		return nil
+	}
+
+	if !d.NewValueKnown("data") {
+		if err := d.SetNewComputed("data_changes"); err != nil {
+			return err
+		}
+		return d.SetNewComputed("objects")
+	}
+
+	objects, err := parseSavedObjects(d.Get("data").(string))
+	if err != nil {
+		return errors.Wrap(err, "Error when parse data")
+	}
+
+	if d.HasChange("data") {
+		oldData, newData := d.GetChange("data")
+		oldObjects, _ := d.GetChange("objects")
+		changes, err := savedObjectsChanges(oldData.(string), newData.(string), ignoredFields(d), oldObjects.(*schema.Set).List())
+		if err != nil {
+			return errors.Wrap(err, "Error when compare data")
+		}
+		log.Debugf("Objects changes: %+v", changes)
+		if err = d.SetNew("data_changes", changes); err != nil {
+			return err
+		}
+	}
+
+	if d.Get("conflict_resolution").(string) == "skip" {
+		return d.SetNewComputed("objects")
+	}
+
+	return d.SetNew("objects", objects)
 }
 
-// Delete object in Kibana is not supported
-// It just remove object from state
-func resourceKibanaObjectDelete(d *schema.ResourceData, meta interface{}) error {
+// ignoredFields return the fields ignored when compare data with exported objects
+func ignoredFields(d interface {
+	GetOk(string) (interface{}, bool)
+}) []string {
+	if raws, ok := d.GetOk("ignored_fields"); ok {
+		return convertArrayInterfaceToArrayString(raws.([]interface{}))
+	}
+	return defaultIgnoredFields
+}
+
+// Import existing objects in Kibana
+// The ID is formated as space/type:id,type:id, the space can be omitted to use the default space
+// The objects are managed like if they are imported from data, so they are exported with their references
+// The resource ID stay the import ID, name is kept from configuration
+func resourceKibanaObjectImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	space := "default"
+	rawObjects := d.Id()
+	if i := strings.Index(rawObjects, "/"); i >= 0 && !strings.Contains(rawObjects[:i], ":") {
+		space = rawObjects[:i]
+		rawObjects = rawObjects[i+1:]
+	}
+
+	objects, err := parseObjectsID(rawObjects)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Import ID %q must be formated as space/type:id,type:id", d.Id())
+	}
+
+	log.Debugf("Import objects %+v from space %s", objects, space)
+
+	d.Set("space", space)
+	d.Set("objects", objects)
+	d.Set("deep_reference", true)
+	d.Set("conflict_resolution", "overwrite")
+	d.Set("store_data_hash", false)
+	d.Set("delete_on_destroy", true)
+
+	return []*schema.ResourceData{d}, nil
+}
+
+// Delete objects imported in Kibana
+// It just remove object from state when delete_on_destroy is disabled
+func resourceKibanaObjectDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	id := d.Id()
+	space := d.Get("space").(string)
+
+	if !d.Get("delete_on_destroy").(bool) {
+		d.SetId("")
+		log.Infof("Delete object %s is disabled", id)
+		return diagWarning("Delete object %s is disabled - just removing from state", id)
+	}
+
+	objects := buildExportObjects(d.Get("objects").(*schema.Set).List())
+	if _, isHash := parseSavedObjectsHash(d.Get("data").(string)); len(objects) == 0 && !isHash {
+		// State created before objects was tracked, so use the data
+		var err error
+		objects, err = parseSavedObjects(d.Get("data").(string))
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	client, err := getClient(ctx, meta.(*ProviderConf))
+	if err != nil {
+		return diagFromKibanaError(err)
+	}
+
+	var diags diag.Diagnostics
+	for _, object := range objects {
+		err = client.API.KibanaSavedObject.Delete(object["type"], object["id"], space)
+		if err != nil {
+			if isNotFoundError(err) {
+				log.Warnf("Object %s/%s not found in space %s", object["type"], object["id"], space)
+				continue
+			}
+			diags = append(diags, diagFromKibanaError(err)...)
+			continue
+		}
+		log.Debugf("Deleted object %s/%s in space %s", object["type"], object["id"], space)
+	}
+	if diags.HasError() {
+		return diags
+	}
 
 	d.SetId("")
 
-	log.Infof("Delete object in not supported")
-	fmt.Printf("[INFO] Delete object in not supported - just removing from state")
+	log.Infof("Deleted objects %s successfully", id)
 	return nil
 
 }
@@ -173,28 +445,186 @@ func buildExportObjects(raws []interface{}) []map[string]string {
 }
 
 // Import objects in Kibana
-func importObject(d *schema.ResourceData, meta interface{}) error {
+// Objects that failed to import are retried according to the conflict resolution and the references to replace
+// The objects already imported by this resource are always overwritten
+// It fail if Kibana can't import some objects
+func importObject(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	data := d.Get("data").(string)
 	space := d.Get("space").(string)
+	conflictResolution := d.Get("conflict_resolution").(string)
 
 	log.Debugf("Data: %s", data)
 
-	var (
-		importedData map[string]interface{}
-		err          error
-	)
+	objects, err := parseSavedObjects(data)
+	if err != nil {
+		return diagAttributeError("data", err)
+	}
 
-	client, err := getClient(meta.(*ProviderConf))
+	client, err := getClient(ctx, meta.(*ProviderConf))
 	if err != nil {
-		return err
+		return diagFromKibanaError(err)
 	}
 
-	importedData, err = client.API.KibanaSavedObject.Import([]byte(data), true, space)
+	importedData, err := client.API.KibanaSavedObject.Import([]byte(data), conflictResolution == "overwrite", space)
 	if err != nil {
-		return err
+		return diagFromKibanaError(err)
 	}
 
 	log.Debugf("Imported object: %+v", importedData)
 
+	importResponse, err := parseImportResponse(importedData)
+	if err != nil {
+		d.Set("objects", objects)
+		return diag.FromErr(err)
+	}
+	if importResponse.Success {
+		d.Set("objects", objects)
+		return nil
+	}
+	if len(importResponse.Errors) == 0 {
+		d.Set("objects", objects)
+		return diagFromSavedObjectErrors("import", "", nil)
+	}
+
+	unresolvedErrors, skippedObjects, err := resolveObjectImportErrors(client, d, []byte(data), importResponse.Errors)
+
+	// Skipped objects already exist in Kibana and are not managed by this resource
+	d.Set("objects", removeObjects(objects, skippedObjects))
+
+	if err != nil {
+		return diagFromKibanaError(err)
+	}
+	if len(skippedObjects) > 0 {
+		log.Warnf("Skipped %d objects that already exist in space %s", len(skippedObjects), space)
+	}
+	if len(unresolvedErrors) > 0 {
+		return diagFromSavedObjectErrors("import", "", unresolvedErrors)
+	}
+
 	return nil
 }
+
+// resolveObjectImportErrors permit to retry the objects that failed to import
+// Conflicts are skipped when conflict_resolution is skip, and missing references are replaced by replace_references
+// It return the errors that can't be resolved and the skipped objects
+func resolveObjectImportErrors(client *kibana.Client, d *schema.ResourceData, data []byte, importErrors []savedObjectError) ([]savedObjectError, []map[string]string, error) {
+	space := d.Get("space").(string)
+	conflictResolution := d.Get("conflict_resolution").(string)
+	replaceReferences := buildReplaceReferences(d.Get("replace_references").(*schema.Set).List())
+
+	// Objects already imported by this resource are always overwritten
+	managedObjects := map[string]bool{}
+	for _, object := range buildExportObjects(d.Get("objects").(*schema.Set).List()) {
+		managedObjects[savedObjectKey(object["type"], object["id"])] = true
+	}
+
+	unresolvedErrors := make([]savedObjectError, 0)
+	skippedObjects := make([]map[string]string, 0)
+	retries := make([]savedObjectImportRetry, 0)
+	for _, importError := range importErrors {
+		isManaged := managedObjects[savedObjectKey(importError.Type, importError.ID)]
+		switch {
+		case importError.Error.Type == "conflict" && isManaged:
+			retries = append(retries, savedObjectImportRetry{
+				Type:              importError.Type,
+				ID:                importError.ID,
+				Overwrite:         true,
+				ReplaceReferences: make([]savedObjectReplaceReference, 0),
+			})
+		case importError.Error.Type == "conflict" && conflictResolution == "skip":
+			log.Debugf("Skip object %s/%s that already exist", importError.Type, importError.ID)
+			skippedObjects = append(skippedObjects, map[string]string{"type": importError.Type, "id": importError.ID})
+		case importError.Error.Type == "missing_references":
+			references, ok := replaceMissingReferences(importError.Error.References, replaceReferences)
+			if !ok {
+				unresolvedErrors = append(unresolvedErrors, importError)
+				continue
+			}
+			retries = append(retries, savedObjectImportRetry{
+				Type:              importError.Type,
+				ID:                importError.ID,
+				Overwrite:         conflictResolution == "overwrite" || isManaged,
+				ReplaceReferences: references,
+			})
+		default:
+			unresolvedErrors = append(unresolvedErrors, importError)
+		}
+	}
+
+	if len(retries) == 0 {
+		return unresolvedErrors, skippedObjects, nil
+	}
+
+	resolveResponse, err := resolveImportErrors(client, data, retries, space)
+	if err != nil {
+		return nil, skippedObjects, err
+	}
+	log.Debugf("Resolved %d objects", resolveResponse.SuccessCount)
+
+	for _, importError := range resolveResponse.Errors {
+		if importError.Error.Type == "conflict" && conflictResolution == "skip" && !managedObjects[savedObjectKey(importError.Type, importError.ID)] {
+			log.Debugf("Skip object %s/%s that already exist", importError.Type, importError.ID)
+			skippedObjects = append(skippedObjects, map[string]string{"type": importError.Type, "id": importError.ID})
+			continue
+		}
+		unresolvedErrors = append(unresolvedErrors, importError)
+	}
+
+	return unresolvedErrors, skippedObjects, nil
+}
+
+// replaceMissingReferences return the references to replace for all missing references
+// It return false if one missing reference has no replacement
+func replaceMissingReferences(missingReferences []map[string]string, replaceReferences []savedObjectReplaceReference) ([]savedObjectReplaceReference, bool) {
+	references := make([]savedObjectReplaceReference, 0, len(missingReferences))
+	for _, missingReference := range missingReferences {
+		isFound := false
+		for _, replaceReference := range replaceReferences {
+			if replaceReference.Type == missingReference["type"] && replaceReference.From == missingReference["id"] {
+				references = append(references, replaceReference)
+				isFound = true
+				break
+			}
+		}
+		if !isFound {
+			return nil, false
+		}
+	}
+
+	return references, true
+}
+
+// Build list of references to replace
+func buildReplaceReferences(raws []interface{}) []savedObjectReplaceReference {
+
+	results := make([]savedObjectReplaceReference, len(raws))
+
+	for i, raw := range raws {
+		m := raw.(map[string]interface{})
+		results[i] = savedObjectReplaceReference{
+			Type: m["type"].(string),
+			From: m["from"].(string),
+			To:   m["to"].(string),
+		}
+	}
+
+	return results
+
+}
+
+// removeObjects return the objects that are not in the list to remove
+func removeObjects(objects []map[string]string, toRemove []map[string]string) []map[string]string {
+	removed := make(map[string]bool, len(toRemove))
+	for _, object := range toRemove {
+		removed[savedObjectKey(object["type"], object["id"])] = true
+	}
+
+	results := make([]map[string]string, 0, len(objects))
+	for _, object := range objects {
+		if !removed[savedObjectKey(object["type"], object["id"])] {
+			results = append(results, object)
+		}
+	}
+
+	return results
+}
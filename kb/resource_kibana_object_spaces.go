@@ -0,0 +1,311 @@
+// Share Kibana saved object across spaces without copy it
+// API documentation: https://www.elastic.co/guide/en/kibana/master/spaces-api-update-objects-spaces.html
+// Supported version:
+//  - v8
+
+package kb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	kibana "github.com/ggsood/go-kibana-rest/v7"
+	"github.com/ggsood/go-kibana-rest/v7/kbapi"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Resource specification to handle the spaces where kibana saved object is shared
+func resourceKibanaObjectSpaces() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceKibanaObjectSpacesCreate,
+		ReadContext:   resourceKibanaObjectSpacesRead,
+		UpdateContext: resourceKibanaObjectSpacesUpdate,
+		DeleteContext: resourceKibanaObjectSpacesDelete,
+
+		Importer: &schema.ResourceImporter{
+			StateContext: resourceKibanaObjectSpacesImport,
+		},
+
+		CustomizeDiff: customdiff.All(
+			checkKibanaCapabilities("kibana_object_spaces"),
+			customizeDiffKibanaObjectSpaces,
+		),
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Read:   schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"space": {
+				Type:     schema.TypeString,
+				Optional: true,
+				ForceNew: true,
+				Default:  "default",
+			},
+			"object_type": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"object_id": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"spaces": {
+				Type:     schema.TypeSet,
+				Required: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"include_references": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+		},
+	}
+}
+
+// customizeDiffKibanaObjectSpaces check that spaces not contain the space where object is read
+// Object is always kept in this space, so it's never read on spaces and would be planned again on each apply
+func customizeDiffKibanaObjectSpaces(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if !d.NewValueKnown("space") || !d.NewValueKnown("spaces") {
+		return nil
+	}
+
+	space := d.Get("space").(string)
+	if d.Get("spaces").(*schema.Set).Contains(space) {
+		return errors.Errorf("spaces must not contain the space %s where object is read, object is always kept in it", space)
+	}
+
+	return nil
+}
+
+// Share object to spaces
+func resourceKibanaObjectSpacesCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	space := d.Get("space").(string)
+	objectType := d.Get("object_type").(string)
+	objectID := d.Get("object_id").(string)
+	spaces := convertArrayInterfaceToArrayString(d.Get("spaces").(*schema.Set).List())
+
+	diags := updateObjectSpaces(ctx, d, meta, spaces, nil)
+	if diags.HasError() {
+		return diags
+	}
+
+	d.SetId(fmt.Sprintf("%s/%s:%s", space, objectType, objectID))
+
+	log.Infof("Shared object %s/%s to spaces %s successfully", objectType, objectID, strings.Join(spaces, ","))
+
+	return resourceKibanaObjectSpacesRead(ctx, d, meta)
+}
+
+// Read the spaces where object is shared
+// The space where object is read is not part of spaces
+func resourceKibanaObjectSpacesRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+
+	id := d.Id()
+	space := d.Get("space").(string)
+	objectType := d.Get("object_type").(string)
+	objectID := d.Get("object_id").(string)
+
+	log.Debugf("Resource id:  %s", id)
+	log.Debugf("Space: %s", space)
+	log.Debugf("Object: %s/%s", objectType, objectID)
+
+	client, err := getClient(ctx, meta.(*ProviderConf))
+	if err != nil {
+		return diagFromKibanaError(err)
+	}
+
+	object, err := client.API.KibanaSavedObject.Get(objectType, objectID, space)
+	if err != nil && !isNotFoundError(err) {
+		return diagFromKibanaError(err)
+	}
+	if object == nil {
+		log.Warnf("Object %s not found - removing from state", id)
+		d.SetId("")
+		return diagWarning("Object %s not found - removing from state", id)
+	}
+
+	namespaces, _ := object["namespaces"].([]interface{})
+	spaces := make([]string, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		if namespace.(string) != space {
+			spaces = append(spaces, namespace.(string))
+		}
+	}
+
+	log.Debugf("Object %s is shared to spaces %+v", id, spaces)
+
+	d.Set("space", space)
+	d.Set("object_type", objectType)
+	d.Set("object_id", objectID)
+	d.Set("spaces", spaces)
+
+	log.Infof("Read resource %s successfully", id)
+
+	return nil
+}
+
+// Update the spaces where object is shared
+func resourceKibanaObjectSpacesUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	id := d.Id()
+
+	oldSpaces, newSpaces := d.GetChange("spaces")
+	spacesToAdd := convertArrayInterfaceToArrayString(newSpaces.(*schema.Set).Difference(oldSpaces.(*schema.Set)).List())
+	spacesToRemove := convertArrayInterfaceToArrayString(oldSpaces.(*schema.Set).Difference(newSpaces.(*schema.Set)).List())
+
+	// References are shared to spaces where object is already shared when include_references is enabled
+	if d.HasChange("include_references") && d.Get("include_references").(bool) {
+		spacesToAdd = convertArrayInterfaceToArrayString(newSpaces.(*schema.Set).List())
+	}
+
+	diags := updateObjectSpaces(ctx, d, meta, spacesToAdd, spacesToRemove)
+	if diags.HasError() {
+		return diags
+	}
+
+	log.Infof("Updated resource %s successfully", id)
+
+	return resourceKibanaObjectSpacesRead(ctx, d, meta)
+}
+
+// Import the spaces where object is shared
+// The ID is formated as space/type:id
+func resourceKibanaObjectSpacesImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	parts := strings.SplitN(d.Id(), "/", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return nil, errors.Errorf("Import ID %q must be formated as space/type:id", d.Id())
+	}
+
+	objects, err := parseObjectsID(parts[1])
+	if err != nil || len(objects) != 1 {
+		return nil, errors.Errorf("Import ID %q must be formated as space/type:id", d.Id())
+	}
+
+	log.Debugf("Import spaces of object %+v from space %s", objects[0], parts[0])
+
+	d.Set("space", parts[0])
+	d.Set("object_type", objects[0]["type"])
+	d.Set("object_id", objects[0]["id"])
+	d.Set("include_references", false)
+
+	return []*schema.ResourceData{d}, nil
+}
+
+// Remove object from spaces where it's shared
+func resourceKibanaObjectSpacesDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	id := d.Id()
+	space := d.Get("space").(string)
+	objectType := d.Get("object_type").(string)
+	objectID := d.Get("object_id").(string)
+	spaces := convertArrayInterfaceToArrayString(d.Get("spaces").(*schema.Set).List())
+
+	client, err := getClient(ctx, meta.(*ProviderConf))
+	if err != nil {
+		return diagFromKibanaError(err)
+	}
+
+	object, err := client.API.KibanaSavedObject.Get(objectType, objectID, space)
+	if err != nil && !isNotFoundError(err) {
+		return diagFromKibanaError(err)
+	}
+	if object == nil {
+		log.Warnf("Object %s not found - removing from state", id)
+		d.SetId("")
+		return diagWarning("Object %s not found - removing from state", id)
+	}
+
+	diags := updateObjectSpaces(ctx, d, meta, nil, spaces)
+	if diags.HasError() {
+		return diags
+	}
+
+	d.SetId("")
+
+	log.Infof("Removed object %s from spaces %s successfully", id, strings.Join(spaces, ","))
+	return nil
+}
+
+// updateObjectSpaces permit to add and remove object from spaces
+// When include_references is true, the references of object are also added and removed from spaces
+func updateObjectSpaces(ctx context.Context, d *schema.ResourceData, meta interface{}, spacesToAdd []string, spacesToRemove []string) diag.Diagnostics {
+	space := d.Get("space").(string)
+	objectType := d.Get("object_type").(string)
+	objectID := d.Get("object_id").(string)
+	includeReferences := d.Get("include_references").(bool)
+
+	log.Debugf("Space: %s", space)
+	log.Debugf("Object: %s/%s", objectType, objectID)
+	log.Debugf("Include references: %t", includeReferences)
+	log.Debugf("Spaces to add: %+v", spacesToAdd)
+	log.Debugf("Spaces to remove: %+v", spacesToRemove)
+
+	if len(spacesToAdd) == 0 && len(spacesToRemove) == 0 {
+		return nil
+	}
+
+	client, err := getClient(ctx, meta.(*ProviderConf))
+	if err != nil {
+		return diagFromKibanaError(err)
+	}
+
+	objects := []kbapi.KibanaSpaceObjectParameter{{Type: objectType, ID: objectID}}
+	if includeReferences {
+		if objects, err = shareableObjects(client, objects, space); err != nil {
+			return diagFromKibanaError(err)
+		}
+	}
+
+	results, err := updateObjectsSpaces(client, objects, spacesToAdd, spacesToRemove, space)
+	if err != nil {
+		return diagFromKibanaError(err)
+	}
+
+	objectErrors := make([]savedObjectError, 0)
+	for _, result := range results {
+		if result.Error != nil {
+			objectError := *result.Error
+			objectError.Type = result.Type
+			objectError.ID = result.ID
+			objectErrors = append(objectErrors, objectError)
+		}
+	}
+	if len(objectErrors) > 0 {
+		return diagFromSavedObjectErrors("update spaces of", space, objectErrors)
+	}
+
+	return nil
+}
+
+// shareableObjects return the objects and their references that exist
+func shareableObjects(client *kibana.Client, objects []kbapi.KibanaSpaceObjectParameter, space string) ([]kbapi.KibanaSpaceObjectParameter, error) {
+	references, err := getShareableReferences(client, objects, space)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]kbapi.KibanaSpaceObjectParameter, 0, len(references))
+	for _, reference := range references {
+		if reference.IsMissing {
+			log.Warnf("Reference %s/%s not found in space %s", reference.Type, reference.ID, space)
+			continue
+		}
+		results = append(results, kbapi.KibanaSpaceObjectParameter{Type: reference.Type, ID: reference.ID})
+	}
+
+	return results, nil
+}
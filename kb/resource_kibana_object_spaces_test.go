@@ -0,0 +1,241 @@
+package kb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ggsood/go-kibana-rest/v7/kbapi"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/pkg/errors"
+)
+
+func TestAccKibanaObjectSpaces(t *testing.T) {
+
+	resource.Test(t, resource.TestCase{
+		PreCheck: func() {
+			testAccPreCheck(t)
+			testAccPreCheckKibanaCapabilities(t, "kibana_object_spaces")
+		},
+		Providers:    testAccProviders,
+		CheckDestroy: testCheckKibanaObjectSpacesDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testKibanaObjectSpaces,
+				Check: resource.ComposeTestCheckFunc(
+					testCheckKibanaObjectSpacesExists("kibana_object_spaces.test"),
+				),
+			},
+			{
+				ResourceName:      "kibana_object_spaces.test",
+				ImportState:       true,
+				ImportStateId:     "default/index-pattern:test",
+				ImportStateVerify: true,
+			},
+		},
+	})
+}
+
+func testCheckKibanaObjectSpacesExists(name string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		rs, ok := s.RootModule().Resources[name]
+		if !ok {
+			return fmt.Errorf("Not found: %s", name)
+		}
+		if rs.Primary.ID == "" {
+			return fmt.Errorf("No object spaces ID is set")
+		}
+
+		meta := testAccProvider.Meta()
+
+		client, err := getClient(context.Background(), meta.(*ProviderConf))
+		if err != nil {
+			return err
+		}
+
+		object, err := client.API.KibanaSavedObject.Get(rs.Primary.Attributes["object_type"], rs.Primary.Attributes["object_id"], "terraform-test3")
+		if err != nil {
+			return err
+		}
+		if object == nil {
+			return errors.Errorf("Object %s not shared to space terraform-test3", rs.Primary.ID)
+		}
+
+		return nil
+	}
+}
+
+func testCheckKibanaObjectSpacesDestroy(s *terraform.State) error {
+	for _, rs := range s.RootModule().Resources {
+		if rs.Type != "kibana_object_spaces" {
+			continue
+		}
+
+		meta := testAccProvider.Meta()
+
+		client, err := getClient(context.Background(), meta.(*ProviderConf))
+		if err != nil {
+			return err
+		}
+
+		object, err := client.API.KibanaSavedObject.Get(rs.Primary.Attributes["object_type"], rs.Primary.Attributes["object_id"], "terraform-test3")
+		if err != nil && !isNotFoundError(err) {
+			return err
+		}
+		if object == nil {
+			return nil
+		}
+
+		return fmt.Errorf("Object %q is still shared", rs.Primary.ID)
+	}
+
+	return nil
+}
+
+var testKibanaObjectSpaces = `
+resource kibana_object "test" {
+  name 				= "terraform-test"
+  data				= "${file("../fixtures/test.ndjson")}"
+}
+
+resource kibana_user_space "test" {
+  name 				= "terraform-test3"
+}
+
+resource kibana_object_spaces "test" {
+  object_type		= "index-pattern"
+  object_id			= "test"
+  spaces			= ["${kibana_user_space.test.name}"]
+
+  depends_on = [kibana_object.test]
+}
+`
+
+func TestKibanaObjectSpacesLifecycle(t *testing.T) {
+	fake := newFakeKibana(t, "8.0.0")
+	meta := fake.conf()
+	ctx := context.Background()
+	r := resourceKibanaObjectSpaces()
+
+	fake.spaces["team-a"] = &kbapi.KibanaSpace{ID: "team-a", Name: "team-a"}
+	fake.spaces["team-b"] = &kbapi.KibanaSpace{ID: "team-b", Name: "team-b"}
+	fake.addObject("default", map[string]interface{}{
+		"id":         "ref",
+		"type":       "index-pattern",
+		"attributes": map[string]interface{}{"title": "ref"},
+	})
+	fake.addObject("default", map[string]interface{}{
+		"id":         "test",
+		"type":       "visualization",
+		"attributes": map[string]interface{}{"title": "test"},
+		"references": []interface{}{
+			map[string]interface{}{"name": "index", "type": "index-pattern", "id": "ref"},
+		},
+	})
+
+	config := map[string]interface{}{
+		"object_type": "visualization",
+		"object_id":   "test",
+		"spaces":      []interface{}{"team-a"},
+	}
+
+	// Create
+	d := schema.TestResourceDataRaw(t, r.Schema, config)
+	testCheckDiags(t, r.CreateContext(ctx, d, meta))
+	if d.Id() != "default/visualization:test" || fake.getObject("team-a", "visualization", "test") == nil {
+		t.Fatal("Object must be shared to space")
+	}
+	if fake.getObject("team-a", "index-pattern", "ref") != nil {
+		t.Fatal("References must not be shared without include_references")
+	}
+	if d.Get("spaces").(*schema.Set).Len() != 1 || !d.Get("spaces").(*schema.Set).Contains("team-a") {
+		t.Fatalf("Spaces must be read from namespaces, got %+v", d.Get("spaces"))
+	}
+
+	// Update spaces with references
+	config["spaces"] = []interface{}{"team-b"}
+	config["include_references"] = true
+	d = testResourceDataUpdate(t, r, d.State(), config, meta)
+	testCheckDiags(t, r.UpdateContext(ctx, d, meta))
+	if fake.getObject("team-a", "visualization", "test") != nil || fake.getObject("team-b", "visualization", "test") == nil || fake.getObject("team-b", "index-pattern", "ref") == nil {
+		t.Fatal("Object must be moved from team-a to team-b with its references")
+	}
+
+	// Drift when object is shared outside Terraform
+	fake.objects["team-a"]["visualization/test"] = fake.getObject("default", "visualization", "test")
+	fake.getObject("default", "visualization", "test")["namespaces"] = []interface{}{"default", "team-a", "team-b"}
+	testCheckDiags(t, r.ReadContext(ctx, d, meta))
+	if d.Get("spaces").(*schema.Set).Len() != 2 {
+		t.Fatalf("Space where object is shared outside Terraform must be read, got %+v", d.Get("spaces"))
+	}
+
+	// Delete
+	testCheckDiags(t, r.DeleteContext(ctx, d, meta))
+	if d.Id() != "" || fake.getObject("team-a", "visualization", "test") != nil || fake.getObject("team-b", "visualization", "test") != nil || fake.getObject("team-b", "index-pattern", "ref") != nil {
+		t.Fatal("Object and references must be removed from spaces")
+	}
+	if fake.getObject("default", "visualization", "test") == nil {
+		t.Fatal("Object must be kept in its space")
+	}
+
+	// Drift when object is deleted outside Terraform
+	d.SetId("default/visualization:missing")
+	d.Set("object_id", "missing")
+	testCheckDiagsWarning(t, r.ReadContext(ctx, d, meta))
+	if d.Id() != "" {
+		t.Fatal("Missing object must be removed from state")
+	}
+
+	// Share missing object
+	d = schema.TestResourceDataRaw(t, r.Schema, map[string]interface{}{
+		"object_type": "visualization",
+		"object_id":   "missing",
+		"spaces":      []interface{}{"team-a"},
+	})
+	testCheckDiagsError(t, r.CreateContext(ctx, d, meta), "visualization missing")
+	if d.Id() != "" {
+		t.Fatal("Resource must not be created when object can't be shared")
+	}
+
+	// Spaces can't contain the space where object is read
+	config["spaces"] = []interface{}{"default", "team-a"}
+	if _, err := r.Diff(ctx, nil, terraform.NewResourceConfigRaw(config), meta); err == nil || !strings.Contains(err.Error(), "space default") {
+		t.Fatalf("Spaces with the space where object is read must failed, got %v", err)
+	}
+
+	// Need Kibana 8
+	config["spaces"] = []interface{}{"team-a"}
+	fake.version = "7.17.0"
+	if _, err := r.Diff(ctx, nil, terraform.NewResourceConfigRaw(config), fake.conf()); err == nil {
+		t.Fatal("kibana_object_spaces must failed with Kibana 7")
+	}
+}
+
+func TestKibanaObjectSpacesImport(t *testing.T) {
+	fake := newFakeKibana(t, "8.0.0")
+	meta := fake.conf()
+	ctx := context.Background()
+	r := resourceKibanaObjectSpaces()
+
+	d := r.Data(nil)
+	d.SetId("team-a/dashboard:test")
+	states, err := r.Importer.StateContext(ctx, d, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d = states[0]
+	if d.Get("space").(string) != "team-a" || d.Get("object_type").(string) != "dashboard" || d.Get("object_id").(string) != "test" {
+		t.Fatalf("Space and object must be set, got %+v", d.State())
+	}
+
+	for _, id := range []string{"dashboard:test", "team-a/dashboard:test,index-pattern:test", "team-a/test"} {
+		d = r.Data(nil)
+		d.SetId(id)
+		if _, err = r.Importer.StateContext(ctx, d, meta); err == nil {
+			t.Fatalf("Import ID %q must failed", id)
+		}
+	}
+}
@@ -1,13 +1,17 @@
 package kb
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"strings"
 	"testing"
 
-	"github.com/hashicorp/terraform-plugin-sdk/helper/resource"
-	"github.com/hashicorp/terraform-plugin-sdk/terraform"
+	"github.com/ggsood/go-kibana-rest/v7/kbapi"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 	"github.com/pkg/errors"
-	log "github.com/sirupsen/logrus"
 )
 
 func TestAccKibanaObject(t *testing.T) {
@@ -26,6 +30,14 @@ func TestAccKibanaObject(t *testing.T) {
 				),
 				ExpectNonEmptyPlan: true,
 			},
+			{
+				ResourceName:      "kibana_object.test",
+				ImportState:       true,
+				ImportStateId:     "default/index-pattern:logstash-log-*",
+				ImportStateVerify: true,
+				// The name and the export options are not part of import ID
+				ImportStateVerifyIgnore: []string{"name", "export_types", "data", "objects"},
+			},
 		},
 	})
 }
@@ -50,7 +62,7 @@ func testCheckKibanaObjectExists(name string) resource.TestCheckFunc {
 
 		meta := testAccProvider.Meta()
 
-		client, err := getClient(meta.(*ProviderConf))
+		client, err := getClient(context.Background(), meta.(*ProviderConf))
 		if err != nil {
 			return err
 		}
@@ -73,7 +85,21 @@ func testCheckKibanaObjectDestroy(s *terraform.State) error {
 			continue
 		}
 
-		log.Debugf("We never delete kibana object")
+		meta := testAccProvider.Meta()
+
+		client, err := getClient(context.Background(), meta.(*ProviderConf))
+		if err != nil {
+			return err
+		}
+		object, err := client.API.KibanaSavedObject.Get("index-pattern", "logstash-log-*", "default")
+		if err != nil {
+			return err
+		}
+		if object == nil {
+			return nil
+		}
+
+		return fmt.Errorf("Object %q still exists", "logstash-log-*")
 	}
 
 	return nil
@@ -87,3 +113,426 @@ resource "kibana_object" "test" {
   export_types    	= ["index-pattern"]
 }
 `
+
+func TestKibanaObjectLifecycle(t *testing.T) {
+	for _, version := range testKibanaVersions {
+		t.Run(version, func(t *testing.T) {
+			testKibanaObjectLifecycle(t, version)
+		})
+	}
+}
+
+func testKibanaObjectLifecycle(t *testing.T, version string) {
+	fake := newFakeKibana(t, version)
+	meta := fake.conf()
+	ctx := context.Background()
+	r := resourceKibanaObject()
+
+	config := map[string]interface{}{
+		"name":         "test",
+		"data":         `{"id":"test","type":"index-pattern","attributes":{"title":"test"}}`,
+		"export_types": []interface{}{"index-pattern"},
+	}
+	d := schema.TestResourceDataRaw(t, r.Schema, config)
+
+	// Create
+	testCheckDiags(t, r.CreateContext(ctx, d, meta))
+	if d.Id() != "test" || fake.getObject("default", "index-pattern", "test") == nil {
+		t.Fatal("Object must be imported")
+	}
+	if !strings.Contains(d.Get("data").(string), `"title":"test"`) {
+		t.Fatalf("Object must be exported, got %s", d.Get("data").(string))
+	}
+
+	// No drift with the fields that Kibana add on export
+	diff, err := r.Diff(ctx, d.State(), terraform.NewResourceConfigRaw(config), meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff != nil && len(diff.Attributes) > 0 {
+		t.Fatalf("No diff expected, got %+v", diff.Attributes)
+	}
+
+	// Rename is an update that not import objects again
+	config["name"] = "renamed"
+	if diff, err = r.Diff(ctx, d.State(), terraform.NewResourceConfigRaw(config), meta); err != nil {
+		t.Fatal(err)
+	}
+	if diff.RequiresNew() {
+		t.Fatal("Rename must not replace objects")
+	}
+	d = testResourceDataUpdate(t, r, d.State(), config, meta)
+	nbRequests := len(fake.requests)
+	testCheckDiags(t, r.UpdateContext(ctx, d, meta))
+	for _, request := range fake.requests[nbRequests:] {
+		if strings.Contains(request, "_import") {
+			t.Fatalf("Objects must not be imported on rename, got %s", request)
+		}
+	}
+	if d.Id() != "test" || d.Get("name").(string) != "renamed" {
+		t.Fatalf("Rename must keep the resource ID, got %s", d.Id())
+	}
+
+	// Update
+	config["data"] = `{"id":"test","type":"index-pattern","attributes":{"title":"updated"}}`
+	d = testResourceDataUpdate(t, r, d.State(), config, meta)
+	testCheckDiags(t, r.UpdateContext(ctx, d, meta))
+	if fake.getObject("default", "index-pattern", "test")["attributes"].(map[string]interface{})["title"] != "updated" {
+		t.Fatal("Object must be updated")
+	}
+
+	// Kibana error
+	fake.failNext(http.MethodPost, "/api/saved_objects/_import", http.StatusRequestEntityTooLarge, "Payload content length greater than maximum allowed")
+	testCheckDiagsError(t, r.UpdateContext(ctx, d, meta), "Payload content length")
+
+	// Delete only the imported objects
+	fake.addObject("default", map[string]interface{}{
+		"id":         "other",
+		"type":       "index-pattern",
+		"attributes": map[string]interface{}{"title": "other"},
+	})
+	fake.failNext(http.MethodDelete, "/api/saved_objects/index-pattern/test", http.StatusForbidden, "Unable to delete index-pattern")
+	testCheckDiagsError(t, r.DeleteContext(ctx, d, meta), "Unable to delete index-pattern")
+	if d.Id() == "" {
+		t.Fatal("Object must be kept on state when delete failed")
+	}
+	testCheckDiags(t, r.DeleteContext(ctx, d, meta))
+	if d.Id() != "" || fake.getObject("default", "index-pattern", "test") != nil {
+		t.Fatal("Object must be deleted")
+	}
+	if fake.getObject("default", "index-pattern", "other") == nil {
+		t.Fatal("Object not imported by the resource must be kept")
+	}
+
+	// Delete object that not exist anymore
+	d.SetId("test")
+	testCheckDiags(t, r.DeleteContext(ctx, d, meta))
+
+	// Keep objects on destroy
+	d.SetId("test")
+	d.Set("delete_on_destroy", false)
+	d.Set("objects", []interface{}{map[string]interface{}{"id": "other", "type": "index-pattern"}})
+	testCheckDiagsWarning(t, r.DeleteContext(ctx, d, meta))
+	if fake.getObject("default", "index-pattern", "other") == nil {
+		t.Fatal("Object must be kept when delete_on_destroy is disabled")
+	}
+}
+
+func TestKibanaObjectImportErrors(t *testing.T) {
+	fake := newFakeKibana(t, "7.10.2")
+	meta := fake.conf()
+	ctx := context.Background()
+	r := resourceKibanaObject()
+
+	d := schema.TestResourceDataRaw(t, r.Schema, map[string]interface{}{
+		"name": "test",
+		"data": `{"id":"test","type":"index-pattern","attributes":{"title":"test"}}
+{"id":"test","type":"visualization","attributes":{"title":"test"},"references":[{"name":"kibanaSavedObjectMeta.searchSourceJSON.index","type":"index-pattern","id":"missing"}]}`,
+		"export_types": []interface{}{"index-pattern", "visualization"},
+	})
+
+	diags := r.CreateContext(ctx, d, meta)
+	testCheckDiagsError(t, diags, "Failed to import visualization test (test): missing_references")
+	if len(diags) != 1 || !strings.Contains(diags[0].Detail, "index-pattern missing") {
+		t.Fatalf("Missing references must be provided, got %+v", diags)
+	}
+	if d.Id() != "test" || fake.getObject("default", "index-pattern", "test") == nil {
+		t.Fatal("Objects imported must be kept on state")
+	}
+	if fake.getObject("default", "visualization", "test") != nil {
+		t.Fatal("Object with missing references must not be imported")
+	}
+
+	// Kibana failed without errors
+	fake.respondNext(http.MethodPost, "/api/saved_objects/_import", http.StatusOK, map[string]interface{}{
+		"success":      false,
+		"successCount": 0,
+	})
+	d = schema.TestResourceDataRaw(t, r.Schema, map[string]interface{}{
+		"name": "test",
+		"data": `{"id":"test","type":"index-pattern","attributes":{"title":"test"}}`,
+	})
+	testCheckDiagsError(t, r.CreateContext(ctx, d, meta), "Kibana failed to import saved objects without providing errors")
+}
+
+func TestKibanaObjectConflictResolution(t *testing.T) {
+	fake := newFakeKibana(t, "7.10.2")
+	meta := fake.conf()
+	ctx := context.Background()
+	r := resourceKibanaObject()
+
+	fake.addObject("default", map[string]interface{}{
+		"id":         "manual",
+		"type":       "index-pattern",
+		"attributes": map[string]interface{}{"title": "manual"},
+	})
+	fake.addObject("default", map[string]interface{}{
+		"id":         "existing",
+		"type":       "index-pattern",
+		"attributes": map[string]interface{}{"title": "existing"},
+	})
+
+	d := schema.TestResourceDataRaw(t, r.Schema, map[string]interface{}{
+		"name": "test",
+		"data": `{"id":"manual","type":"index-pattern","attributes":{"title":"terraform"}}
+{"id":"test","type":"visualization","attributes":{"title":"test"},"references":[{"name":"kibanaSavedObjectMeta.searchSourceJSON.index","type":"index-pattern","id":"missing"}]}`,
+		"export_types":        []interface{}{"visualization"},
+		"conflict_resolution": "skip",
+		"replace_references": []interface{}{
+			map[string]interface{}{
+				"type": "index-pattern",
+				"from": "missing",
+				"to":   "existing",
+			},
+		},
+	})
+
+	// Create skip existing object and remap missing references
+	testCheckDiags(t, r.CreateContext(ctx, d, meta))
+	if fake.getObject("default", "index-pattern", "manual")["attributes"].(map[string]interface{})["title"] != "manual" {
+		t.Fatal("Existing object must be skipped")
+	}
+	visualization := fake.getObject("default", "visualization", "test")
+	if visualization == nil {
+		t.Fatal("Object with missing references must be imported")
+	}
+	if visualization["references"].([]interface{})[0].(map[string]interface{})["id"] != "existing" {
+		t.Fatalf("Missing reference must be replaced, got %+v", visualization["references"])
+	}
+	objects := d.Get("objects").(*schema.Set).List()
+	if len(objects) != 1 || objects[0].(map[string]interface{})["type"] != "visualization" {
+		t.Fatalf("Skipped objects must not be managed, got %+v", objects)
+	}
+
+	// Update overwrite objects managed by the resource
+	d.Set("data", `{"id":"manual","type":"index-pattern","attributes":{"title":"terraform"}}
+{"id":"test","type":"visualization","attributes":{"title":"updated"},"references":[{"name":"kibanaSavedObjectMeta.searchSourceJSON.index","type":"index-pattern","id":"existing"}]}`)
+	testCheckDiags(t, r.UpdateContext(ctx, d, meta))
+	if fake.getObject("default", "visualization", "test")["attributes"].(map[string]interface{})["title"] != "updated" {
+		t.Fatal("Managed object must be overwritten")
+	}
+	if fake.getObject("default", "index-pattern", "manual")["attributes"].(map[string]interface{})["title"] != "manual" {
+		t.Fatal("Existing object must be skipped")
+	}
+
+	// Missing references without replacement
+	d.Set("data", `{"id":"test","type":"visualization","attributes":{"title":"updated"},"references":[{"name":"kibanaSavedObjectMeta.searchSourceJSON.index","type":"index-pattern","id":"other"}]}`)
+	testCheckDiagsError(t, r.UpdateContext(ctx, d, meta), "missing_references")
+}
+
+func TestKibanaObjectImport(t *testing.T) {
+	fake := newFakeKibana(t, "7.10.2")
+	meta := fake.conf()
+	ctx := context.Background()
+	r := resourceKibanaObject()
+
+	fake.spaces["test"] = &kbapi.KibanaSpace{ID: "test", Name: "test"}
+	raw := map[string]interface{}{
+		"name":  "test",
+		"space": "test",
+		"data":  `{"id":"test","type":"index-pattern","attributes":{"title":"test"}}`,
+	}
+	d := schema.TestResourceDataRaw(t, r.Schema, raw)
+	testCheckDiags(t, r.CreateContext(ctx, d, meta))
+
+	d = r.Data(nil)
+	d.SetId("test/index-pattern:test")
+	states, err := r.Importer.StateContext(ctx, d, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d = states[0]
+	testCheckDiags(t, r.ReadContext(ctx, d, meta))
+	if d.Id() != "test/index-pattern:test" || d.Get("space").(string) != "test" || d.Get("objects").(*schema.Set).Len() != 1 {
+		t.Fatalf("Space and objects must be set, got %+v", d.State())
+	}
+	if !strings.Contains(d.Get("data").(string), `"title":"test"`) {
+		t.Fatalf("Objects must be exported on data, got %s", d.Get("data").(string))
+	}
+
+	// Imported objects has no diff with configuration
+	diff, err := r.Diff(ctx, d.State(), terraform.NewResourceConfigRaw(raw), meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff != nil && !diff.Empty() {
+		t.Fatalf("Imported objects must not drift, got %+v", diff)
+	}
+
+	// Import from default space
+	d = r.Data(nil)
+	d.SetId("index-pattern:test,dashboard:test")
+	states, err = r.Importer.StateContext(ctx, d, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if states[0].Get("space").(string) != "default" || states[0].Get("objects").(*schema.Set).Len() != 2 || states[0].Get("export_objects").(*schema.Set).Len() != 0 {
+		t.Fatalf("Default space and objects must be set, got %+v", states[0].State())
+	}
+
+	// Invalid import ID
+	d = r.Data(nil)
+	d.SetId("test/index-pattern")
+	if _, err = r.Importer.StateContext(ctx, d, meta); err == nil {
+		t.Fatal("Import ID without object id must failed")
+	}
+}
+
+func TestKibanaObjectExportImportedObjects(t *testing.T) {
+	fake := newFakeKibana(t, "7.10.2")
+	meta := fake.conf()
+	ctx := context.Background()
+	r := resourceKibanaObject()
+
+	fake.addObject("default", map[string]interface{}{
+		"id":         "other",
+		"type":       "index-pattern",
+		"attributes": map[string]interface{}{"title": "other"},
+	})
+
+	data := `{"id":"test","type":"index-pattern","attributes":{"title":"test"}}
+{"id":"test","type":"dashboard","attributes":{"title":"test"}}`
+
+	// Objects are computed at plan time
+	diff, err := r.Diff(ctx, nil, terraform.NewResourceConfigRaw(map[string]interface{}{
+		"name": "test",
+		"data": data,
+	}), meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.Attributes["objects.#"] == nil || diff.Attributes["objects.#"].New != "2" {
+		t.Fatalf("Objects must be computed from data at plan time, got %+v", diff.Attributes)
+	}
+	if _, err = r.Diff(ctx, nil, terraform.NewResourceConfigRaw(map[string]interface{}{
+		"name": "test",
+		"data": `{"type":"dashboard"}`,
+	}), meta); err == nil {
+		t.Fatal("Invalid data must failed at plan time")
+	}
+
+	d := schema.TestResourceDataRaw(t, r.Schema, map[string]interface{}{
+		"name": "test",
+		"data": data,
+	})
+
+	// Only imported objects are exported
+	testCheckDiags(t, r.CreateContext(ctx, d, meta))
+	objects, err := parseSavedObjects(d.Get("data").(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 {
+		t.Fatalf("Imported objects must be exported, got %s", d.Get("data").(string))
+	}
+
+	// Drift when one object is deleted outside Terraform
+	fake.deleteObject("default", "dashboard", "test")
+	testCheckDiags(t, r.ReadContext(ctx, d, meta))
+	objects, err = parseSavedObjects(d.Get("data").(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Id() != "test" || len(objects) != 1 {
+		t.Fatalf("Only existing objects must be exported, got %s", d.Get("data").(string))
+	}
+
+	// Drift when all objects are deleted outside Terraform
+	fake.deleteObject("default", "index-pattern", "test")
+	testCheckDiagsWarning(t, r.ReadContext(ctx, d, meta))
+	if d.Id() != "" {
+		t.Fatal("Object must be removed from state")
+	}
+}
+
+func TestKibanaObjectStoreDataHash(t *testing.T) {
+	fake := newFakeKibana(t, "7.10.2")
+	meta := fake.conf()
+	ctx := context.Background()
+	r := resourceKibanaObject()
+
+	config := map[string]interface{}{
+		"name": "test",
+		"data": `{"id":"test","type":"index-pattern","attributes":{"title":"test"}}
+{"id":"test","type":"dashboard","attributes":{"title":"test"}}`,
+		"store_data_hash": true,
+	}
+	d := schema.TestResourceDataRaw(t, r.Schema, config)
+
+	// Only the hash of objects is stored
+	testCheckDiags(t, r.CreateContext(ctx, d, meta))
+	hashes, ok := parseSavedObjectsHash(d.Get("data").(string))
+	if !ok || len(hashes) != 2 || hashes["dashboard/test"] == "" {
+		t.Fatalf("Hash of objects must be stored in data, got %s", d.Get("data").(string))
+	}
+
+	// No diff when objects not change
+	diff, err := r.Diff(ctx, d.State(), terraform.NewResourceConfigRaw(config), meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff != nil && len(diff.Attributes) > 0 {
+		t.Fatalf("No diff expected, got %+v", diff.Attributes)
+	}
+
+	// Changes are summarized by object
+	config["data"] = `{"id":"test","type":"index-pattern","attributes":{"title":"updated"}}
+{"id":"test","type":"visualization","attributes":{"title":"test"}}`
+	diff, err = r.Diff(ctx, d.State(), terraform.NewResourceConfigRaw(config), meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := []string{}
+	for i := 0; diff.Attributes[fmt.Sprintf("data_changes.%d", i)] != nil; i++ {
+		changes = append(changes, diff.Attributes[fmt.Sprintf("data_changes.%d", i)].New)
+	}
+	expected := []string{"dashboard/test: removed", "index-pattern/test: changed", "visualization/test: added"}
+	if strings.Join(changes, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Changes %+v expected, got %+v", expected, changes)
+	}
+
+	// Plan only show the hash of objects
+	if _, isHash := parseSavedObjectsHash(diff.Attributes["data"].New); !isHash {
+		t.Fatalf("Hash of objects must be planned, got %s", diff.Attributes["data"].New)
+	}
+
+	// Changes are kept after apply and cleared on refresh
+	d = testResourceDataUpdate(t, r, d.State(), config, meta)
+	testCheckDiags(t, r.UpdateContext(ctx, d, meta))
+	if len(d.Get("data_changes").([]interface{})) != 3 {
+		t.Fatalf("Changes must be kept after apply, got %+v", d.Get("data_changes"))
+	}
+	d = r.Data(d.State())
+	testCheckDiags(t, r.ReadContext(ctx, d, meta))
+	if len(d.Get("data_changes").([]interface{})) != 0 {
+		t.Fatalf("Changes must be cleared on refresh, got %+v", d.Get("data_changes"))
+	}
+	diff, err = r.Diff(ctx, d.State(), terraform.NewResourceConfigRaw(config), meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff != nil && len(diff.Attributes) > 0 {
+		t.Fatalf("No diff expected once applied, got %+v", diff.Attributes)
+	}
+
+	// Ignored fields that differ from default ones not make drift
+	ignored := []interface{}{"attributes.description"}
+	for _, field := range defaultIgnoredFields {
+		ignored = append(ignored, field)
+	}
+	config["ignored_fields"] = ignored
+	config["data"] = `{"id":"test","type":"index-pattern","attributes":{"title":"updated"}}
+{"id":"test","type":"visualization","attributes":{"title":"test","description":"test"}}`
+	d = testResourceDataUpdate(t, r, d.State(), config, meta)
+	testCheckDiags(t, r.UpdateContext(ctx, d, meta))
+	fake.getObject("default", "visualization", "test")["attributes"].(map[string]interface{})["description"] = "changed"
+	d = r.Data(d.State())
+	testCheckDiags(t, r.ReadContext(ctx, d, meta))
+	diff, err = r.Diff(ctx, d.State(), terraform.NewResourceConfigRaw(config), meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff != nil && len(diff.Attributes) > 0 {
+		t.Fatalf("No diff expected with ignored fields, got %+v", diff.Attributes)
+	}
+}
@@ -2,28 +2,86 @@
 // API documentation: https://www.elastic.co/guide/en/kibana/master/role-management-api.html
 // Supported version:
 //  - v7
+//  - v8
 
 package kb
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
 
+	kibana "github.com/ggsood/go-kibana-rest/v7"
 	kbapi "github.com/ggsood/go-kibana-rest/v7/kbapi"
 
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
+// kibanaRolePrimaryFeaturePrivileges is the list of feature privileges that are not sub feature privileges
+// The minimal privileges permit to grant sub feature privileges one by one
+var kibanaRolePrimaryFeaturePrivileges = []string{"all", "read", "minimal_all", "minimal_read"}
+
+// kibanaRole is the role API object
+// It's the same as the Kibana client role, with allow_restricted_indices on indices
+type kibanaRole struct {
+	Elasticsearch *kibanaRoleElasticsearch `json:"elasticsearch,omitempty"`
+	Kibana        []kbapi.KibanaRoleKibana `json:"kibana,omitempty"`
+	Metadata      map[string]interface{}   `json:"metadata,omitempty"`
+}
+
+// kibanaRoleElasticsearch is the API Elasticsearch object of role
+type kibanaRoleElasticsearch struct {
+	Indices []kibanaRoleElasticsearchIndice `json:"indices,omitempty"`
+	Cluster []string                        `json:"cluster,omitempty"`
+	RunAs   []string                        `json:"run_as,omitempty"`
+}
+
+// kibanaRoleElasticsearchIndice is the API indice object of role
+type kibanaRoleElasticsearchIndice struct {
+	kbapi.KibanaRoleElasticsearchIndice
+	AllowRestrictedIndices bool `json:"allow_restricted_indices,omitempty"`
+}
+
 // Resource specification to handle role in Kibana
 func resourceKibanaRole() *schema.Resource {
 	return &schema.Resource{
-		Create: resourceKibanaRoleCreate,
-		Read:   resourceKibanaRoleRead,
-		Update: resourceKibanaRoleUpdate,
-		Delete: resourceKibanaRoleDelete,
+		CreateContext: resourceKibanaRoleCreate,
+		ReadContext:   resourceKibanaRoleRead,
+		UpdateContext: resourceKibanaRoleUpdate,
+		DeleteContext: resourceKibanaRoleDelete,
+
+		CustomizeDiff: customdiff.All(
+			checkKibanaCapabilities("kibana_role"),
+			validateKibanaRoleFeatures,
+		),
+
+		SchemaVersion: 1,
+		StateUpgraders: []schema.StateUpgrader{
+			{
+				Version: 0,
+				Type:    resourceKibanaRoleV0().CoreConfigSchema().ImpliedType(),
+				Upgrade: resourceKibanaRoleStateUpgradeV0,
+			},
+		},
 
 		Importer: &schema.ResourceImporter{
-			State: schema.ImportStatePassthrough,
+			StateContext: schema.ImportStatePassthroughContext,
+		},
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Read:   schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
 		},
 
 		Schema: map[string]*schema.Schema{
@@ -56,17 +114,40 @@ func resourceKibanaRole() *schema.Resource {
 											Type: schema.TypeString,
 										},
 									},
+									"allow_restricted_indices": {
+										Type:     schema.TypeBool,
+										Optional: true,
+										Default:  false,
+									},
 									"query": {
 										Type:             schema.TypeString,
 										Optional:         true,
 										Default:          "{}",
+										ValidateFunc:     validation.StringIsJSON,
 										DiffSuppressFunc: suppressEquivalentJSON,
 									},
 									"field_security": {
-										Type:             schema.TypeString,
-										Optional:         true,
-										Default:          "{}",
-										DiffSuppressFunc: suppressEquivalentJSON,
+										Type:     schema.TypeList,
+										Optional: true,
+										MaxItems: 1,
+										Elem: &schema.Resource{
+											Schema: map[string]*schema.Schema{
+												"grant": {
+													Type:     schema.TypeSet,
+													Optional: true,
+													Elem: &schema.Schema{
+														Type: schema.TypeString,
+													},
+												},
+												"except": {
+													Type:     schema.TypeSet,
+													Optional: true,
+													Elem: &schema.Schema{
+														Type: schema.TypeString,
+													},
+												},
+											},
+										},
 									},
 								},
 							},
@@ -119,6 +200,14 @@ func resourceKibanaRole() *schema.Resource {
 									"permissions": {
 										Type:     schema.TypeSet,
 										Required: true,
+										Elem: &schema.Schema{
+											Type:         schema.TypeString,
+											ValidateFunc: validation.StringInSlice(kibanaRolePrimaryFeaturePrivileges, false),
+										},
+									},
+									"sub_feature_privileges": {
+										Type:     schema.TypeSet,
+										Optional: true,
 										Elem: &schema.Schema{
 											Type: schema.TypeString,
 										},
@@ -140,52 +229,68 @@ func resourceKibanaRole() *schema.Resource {
 }
 
 // Create new role in Kibana
-func resourceKibanaRoleCreate(d *schema.ResourceData, meta interface{}) error {
+func resourceKibanaRoleCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 
 	name := d.Get("name").(string)
 
-	err := createRole(d, meta)
-	if err != nil {
-		return err
+	diags := createRole(ctx, d, meta)
+	if diags.HasError() {
+		return diags
 	}
 
 	d.SetId(name)
 
 	log.Infof("Created role %s successfully", name)
 
-	return resourceKibanaRoleRead(d, meta)
+	return resourceKibanaRoleRead(ctx, d, meta)
 }
 
 // Read existing role in Kibana
-func resourceKibanaRoleRead(d *schema.ResourceData, meta interface{}) error {
+func resourceKibanaRoleRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 
 	id := d.Id()
 
 	log.Debugf("Role id:  %s", id)
 
-	client, err := getClient(meta.(*ProviderConf))
+	client, err := getClient(ctx, meta.(*ProviderConf))
 	if err != nil {
-		return err
+		return diagFromKibanaError(err)
 	}
 
-	role, err := client.API.KibanaRoleManagement.Get(id)
+	role, err := getRole(client, id)
 	if err != nil {
-		return err
+		return diagFromKibanaError(err)
 	}
 
 	if role == nil {
-		fmt.Printf("[WARN] Role %s not found - removing from state", id)
 		log.Warnf("Role %s not found - removing from state", id)
 		d.SetId("")
-		return nil
+		return diagWarning("Role %s not found - removing from state", id)
 	}
 
-	log.Debugf("Get role %s successfully:\n%s", id, role)
+	log.Debugf("Get role %s successfully:\n%+v", id, role)
+
+	roleElasticsearch, err := flattenRolesElasticsearch(role.Elasticsearch)
+	if err != nil {
+		return diagAttributeError("elasticsearch", err)
+	}
+	metadata, err := flattenRoleMetadata(role.Metadata)
+	if err != nil {
+		return diagAttributeError("metadata", err)
+	}
 
-	d.Set("name", id)
-	d.Set("elasticsearch", []kbapi.KibanaRoleElasticsearch{*role.Elasticsearch})
-	d.Set("kibana", role.Kibana)
-	d.Set("metadata", role.Metadata)
+	if err = d.Set("name", id); err != nil {
+		return diag.FromErr(err)
+	}
+	if err = d.Set("elasticsearch", roleElasticsearch); err != nil {
+		return diagAttributeError("elasticsearch", err)
+	}
+	if err = d.Set("kibana", flattenRolesKibana(role.Kibana)); err != nil {
+		return diagAttributeError("kibana", err)
+	}
+	if err = d.Set("metadata", metadata); err != nil {
+		return diagAttributeError("metadata", err)
+	}
 
 	log.Infof("Read role %s successfully", id)
 
@@ -193,39 +298,38 @@ func resourceKibanaRoleRead(d *schema.ResourceData, meta interface{}) error {
 }
 
 // Update existing role in Elasticsearch
-func resourceKibanaRoleUpdate(d *schema.ResourceData, meta interface{}) error {
+func resourceKibanaRoleUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	id := d.Id()
 
-	err := createRole(d, meta)
-	if err != nil {
-		return err
+	diags := createRole(ctx, d, meta)
+	if diags.HasError() {
+		return diags
 	}
 
 	log.Infof("Updated role %s successfully", id)
 
-	return resourceKibanaRoleRead(d, meta)
+	return resourceKibanaRoleRead(ctx, d, meta)
 }
 
 // Delete existing role in Elasticsearch
-func resourceKibanaRoleDelete(d *schema.ResourceData, meta interface{}) error {
+func resourceKibanaRoleDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 
 	id := d.Id()
 	log.Debugf("Role id: %s", id)
 
-	client, err := getClient(meta.(*ProviderConf))
+	client, err := getClient(ctx, meta.(*ProviderConf))
 	if err != nil {
-		return err
+		return diagFromKibanaError(err)
 	}
 
 	err = client.API.KibanaRoleManagement.Delete(id)
 	if err != nil {
-		if err.(kbapi.APIError).Code == 404 {
-			fmt.Printf("[WARN] Role %s not found - removing from state", id)
+		if isNotFoundError(err) {
 			log.Warnf("Role %s not found - removing from state", id)
 			d.SetId("")
-			return nil
+			return diagWarning("Role %s not found - removing from state", id)
 		}
-		return err
+		return diagFromKibanaError(err)
 
 	}
 
@@ -237,48 +341,97 @@ func resourceKibanaRoleDelete(d *schema.ResourceData, meta interface{}) error {
 }
 
 // createRole permit to create or update role in Kibana
-func createRole(d *schema.ResourceData, meta interface{}) error {
+func createRole(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	name := d.Get("name").(string)
-	metadataTemp := optionalInterfaceJSON(d.Get("metadata").(string))
-	roleElasticsearch := buildRolesElasticsearch(d.Get("elasticsearch").(*schema.Set).List())
+	metadata, err := optionalMapJSON(d.Get("metadata").(string))
+	if err != nil {
+		return diagAttributeError("metadata", err)
+	}
+	roleElasticsearch, err := buildRolesElasticsearch(d.Get("elasticsearch").(*schema.Set).List())
+	if err != nil {
+		return diagAttributeError("elasticsearch", err)
+	}
 	roleKibana := buildRolesKibana(d.Get("kibana").(*schema.Set).List())
 
-	client, err := getClient(meta.(*ProviderConf))
+	client, err := getClient(ctx, meta.(*ProviderConf))
 	if err != nil {
-		return err
+		return diagFromKibanaError(err)
 	}
 
-	var metadata map[string]interface{}
-	if metadataTemp != nil {
-		metadata = metadataTemp.(map[string]interface{})
-	} else {
-		metadata = nil
-	}
-	role := &kbapi.KibanaRole{
-		Name:          name,
+	role := &kibanaRole{
 		Elasticsearch: roleElasticsearch,
 		Kibana:        roleKibana,
 		Metadata:      metadata,
 	}
 
-	_, err = client.API.KibanaRoleManagement.CreateOrUpdate(role)
+	err = putRole(client, name, role)
+	if err != nil {
+		return diagFromKibanaError(err)
+	}
+
+	return nil
+}
+
+// getRole return the role from Kibana or nil if not exist
+// The Kibana client not yet support allow_restricted_indices, so the API is called directly
+func getRole(client *kibana.Client, name string) (*kibanaRole, error) {
+	path := fmt.Sprintf("/api/security/role/%s", name)
+	log.Debugf("URL to get role: %s", path)
+
+	resp, err := client.Client.R().Get(path)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode() >= http.StatusMultipleChoices {
+		return nil, newKibanaError(resp)
+	}
+	log.Debugf("Response: %s", resp.Body())
+
+	role := &kibanaRole{}
+	if err = json.Unmarshal(resp.Body(), role); err != nil {
+		return nil, errors.Wrap(err, "Error when parse role")
+	}
+
+	return role, nil
+}
+
+// putRole permit to create or update role in Kibana
+func putRole(client *kibana.Client, name string, role *kibanaRole) error {
+	path := fmt.Sprintf("/api/security/role/%s", name)
+	log.Debugf("URL to put role: %s", path)
+
+	jsonData, err := json.Marshal(role)
 	if err != nil {
 		return err
 	}
+	log.Debugf("Role: %s", jsonData)
+
+	resp, err := client.Client.R().
+		SetBody(jsonData).
+		Put(path)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() >= http.StatusMultipleChoices {
+		return newKibanaError(resp)
+	}
 
 	return nil
 }
 
 // buildRolesElasticsearch permit to construct kibanaRoleElasticsearch object
-func buildRolesElasticsearch(raws []interface{}) *kbapi.KibanaRoleElasticsearch {
+func buildRolesElasticsearch(raws []interface{}) (*kibanaRoleElasticsearch, error) {
 	if len(raws) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	// We check only the first, we case use multiple KibanaRoleElasticsearch
 	raw := raws[0].(map[string]interface{})
 
-	kibanaRoleElasticsearch := &kbapi.KibanaRoleElasticsearch{}
+	kibanaRoleElasticsearch := &kibanaRoleElasticsearch{}
 
 	if _, ok := raw["run_as"]; ok {
 		kibanaRoleElasticsearch.RunAs = convertArrayInterfaceToArrayString(raw["run_as"].(*schema.Set).List())
@@ -287,36 +440,137 @@ func buildRolesElasticsearch(raws []interface{}) *kbapi.KibanaRoleElasticsearch
 		kibanaRoleElasticsearch.Cluster = convertArrayInterfaceToArrayString(raw["cluster"].(*schema.Set).List())
 	}
 	if _, ok := raw["indices"]; ok {
-		kibanaRoleElasticsearch.Indices = buildKibanaRoleElasticsearchIndice(raw["indices"].(*schema.Set).List())
+		indices, err := buildKibanaRoleElasticsearchIndice(raw["indices"].(*schema.Set).List())
+		if err != nil {
+			return nil, err
+		}
+		kibanaRoleElasticsearch.Indices = indices
 	}
 
-	return kibanaRoleElasticsearch
+	return kibanaRoleElasticsearch, nil
 
 }
 
-// buildKibanaRoleElasticsearchIndice permit to build list of KibanaRoleElasticsearchIndice
-func buildKibanaRoleElasticsearchIndice(raws []interface{}) []kbapi.KibanaRoleElasticsearchIndice {
-	kibanaRoleElasticsearchIndices := make([]kbapi.KibanaRoleElasticsearchIndice, len(raws))
+// buildKibanaRoleElasticsearchIndice permit to build list of kibanaRoleElasticsearchIndice
+func buildKibanaRoleElasticsearchIndice(raws []interface{}) ([]kibanaRoleElasticsearchIndice, error) {
+	kibanaRoleElasticsearchIndices := make([]kibanaRoleElasticsearchIndice, len(raws))
 	for i, raw := range raws {
 		m := raw.(map[string]interface{})
-		fieldSecurityTemp := optionalInterfaceJSON(m["field_security"].(string))
-		var fieldSecurity map[string]interface{}
-		if fieldSecurityTemp != nil {
-			fieldSecurity = fieldSecurityTemp.(map[string]interface{})
-		} else {
-			fieldSecurity = nil
-		}
-		kibanaRoleElasticsearchIndice := kbapi.KibanaRoleElasticsearchIndice{
-			Names:         convertArrayInterfaceToArrayString(m["names"].(*schema.Set).List()),
-			Privileges:    convertArrayInterfaceToArrayString(m["privileges"].(*schema.Set).List()),
-			Query:         optionalInterfaceJSON(m["query"].(string)),
-			FieldSecurity: fieldSecurity,
+		kibanaRoleElasticsearchIndice := kibanaRoleElasticsearchIndice{
+			KibanaRoleElasticsearchIndice: kbapi.KibanaRoleElasticsearchIndice{
+				Names:         convertArrayInterfaceToArrayString(m["names"].(*schema.Set).List()),
+				Privileges:    convertArrayInterfaceToArrayString(m["privileges"].(*schema.Set).List()),
+				Query:         optionalInterfaceJSON(m["query"].(string)),
+				FieldSecurity: buildKibanaRoleFieldSecurity(m["field_security"].([]interface{})),
+			},
+			AllowRestrictedIndices: m["allow_restricted_indices"].(bool),
 		}
 
 		kibanaRoleElasticsearchIndices[i] = kibanaRoleElasticsearchIndice
 	}
 
-	return kibanaRoleElasticsearchIndices
+	return kibanaRoleElasticsearchIndices, nil
+}
+
+// buildKibanaRoleFieldSecurity permit to build the field security of indice
+func buildKibanaRoleFieldSecurity(raws []interface{}) map[string]interface{} {
+	if len(raws) == 0 || raws[0] == nil {
+		return nil
+	}
+
+	m := raws[0].(map[string]interface{})
+	fieldSecurity := map[string]interface{}{
+		"grant": convertArrayInterfaceToArrayString(m["grant"].(*schema.Set).List()),
+	}
+	if except := m["except"].(*schema.Set); except.Len() > 0 {
+		fieldSecurity["except"] = convertArrayInterfaceToArrayString(except.List())
+	}
+
+	return fieldSecurity
+}
+
+// flattenRolesElasticsearch permit to convert kibanaRoleElasticsearch object to elasticsearch
+// Kibana always return the elasticsearch object, so it's removed when it not grant anything
+func flattenRolesElasticsearch(kibanaRoleElasticsearch *kibanaRoleElasticsearch) ([]interface{}, error) {
+	if kibanaRoleElasticsearch == nil || (len(kibanaRoleElasticsearch.Indices) == 0 && len(kibanaRoleElasticsearch.Cluster) == 0 && len(kibanaRoleElasticsearch.RunAs) == 0) {
+		return nil, nil
+	}
+
+	indices, err := flattenKibanaRoleElasticsearchIndices(kibanaRoleElasticsearch.Indices)
+	if err != nil {
+		return nil, err
+	}
+
+	return []interface{}{
+		map[string]interface{}{
+			"indices": indices,
+			"cluster": kibanaRoleElasticsearch.Cluster,
+			"run_as":  kibanaRoleElasticsearch.RunAs,
+		},
+	}, nil
+}
+
+// flattenKibanaRoleElasticsearchIndices permit to convert list of kibanaRoleElasticsearchIndice to indices
+func flattenKibanaRoleElasticsearchIndices(kibanaRoleElasticsearchIndices []kibanaRoleElasticsearchIndice) ([]interface{}, error) {
+	indices := make([]interface{}, 0, len(kibanaRoleElasticsearchIndices))
+	for _, kibanaRoleElasticsearchIndice := range kibanaRoleElasticsearchIndices {
+		query, err := flattenKibanaRoleQuery(kibanaRoleElasticsearchIndice.Query)
+		if err != nil {
+			return nil, err
+		}
+		indices = append(indices, map[string]interface{}{
+			"names":                    kibanaRoleElasticsearchIndice.Names,
+			"privileges":               kibanaRoleElasticsearchIndice.Privileges,
+			"allow_restricted_indices": kibanaRoleElasticsearchIndice.AllowRestrictedIndices,
+			"query":                    query,
+			"field_security":           flattenKibanaRoleFieldSecurity(kibanaRoleElasticsearchIndice.FieldSecurity),
+		})
+	}
+
+	return indices, nil
+}
+
+// flattenKibanaRoleQuery permit to convert the query of indice to JSON string
+// Kibana return the query as string, but it can be a JSON object
+func flattenKibanaRoleQuery(query interface{}) (string, error) {
+	switch q := query.(type) {
+	case nil:
+		return "{}", nil
+	case string:
+		if q == "" {
+			return "{}", nil
+		}
+		return q, nil
+	default:
+		data, err := json.Marshal(q)
+		if err != nil {
+			return "", errors.Wrap(err, "Error when convert query to JSON")
+		}
+		return string(data), nil
+	}
+}
+
+// flattenKibanaRoleFieldSecurity permit to convert the field security of indice to field_security
+func flattenKibanaRoleFieldSecurity(fieldSecurity map[string]interface{}) []interface{} {
+	if len(fieldSecurity) == 0 {
+		return nil
+	}
+
+	fields := func(raw interface{}) []string {
+		rawFields, _ := raw.([]interface{})
+		results := make([]string, 0, len(rawFields))
+		for _, field := range rawFields {
+			results = append(results, field.(string))
+		}
+		return results
+	}
+
+	return []interface{}{
+		map[string]interface{}{
+			"grant":  fields(fieldSecurity["grant"]),
+			"except": fields(fieldSecurity["except"]),
+		},
+	}
 }
 
 // buildRolesKibana permit to  build list of KibanaRoleKibana object
@@ -338,14 +592,284 @@ func buildRolesKibana(raws []interface{}) []kbapi.KibanaRoleKibana {
 	return kibanaRoleKibanas
 }
 
+// flattenRolesKibana permit to convert list of KibanaRoleKibana object to kibana
+func flattenRolesKibana(kibanaRoleKibanas []kbapi.KibanaRoleKibana) []interface{} {
+	results := make([]interface{}, 0, len(kibanaRoleKibanas))
+
+	for _, kibanaRoleKibana := range kibanaRoleKibanas {
+		results = append(results, map[string]interface{}{
+			"base":     kibanaRoleKibana.Base,
+			"spaces":   kibanaRoleKibana.Spaces,
+			"features": flattenKibanaRoleKibanaFeatures(kibanaRoleKibana.Feature),
+		})
+	}
+
+	return results
+}
+
+// flattenKibanaRoleKibanaFeatures permit to convert feature map to features, sorted by name
+// The privileges of feature are split between permissions and sub feature privileges
+func flattenKibanaRoleKibanaFeatures(features map[string][]string) []interface{} {
+	names := make([]string, 0, len(features))
+	for name := range features {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		permissions := make([]string, 0, len(features[name]))
+		subFeaturePrivileges := make([]string, 0)
+		for _, privilege := range features[name] {
+			if isKibanaRolePrimaryFeaturePrivilege(privilege) {
+				permissions = append(permissions, privilege)
+			} else {
+				subFeaturePrivileges = append(subFeaturePrivileges, privilege)
+			}
+		}
+		results = append(results, map[string]interface{}{
+			"name":                   name,
+			"permissions":            permissions,
+			"sub_feature_privileges": subFeaturePrivileges,
+		})
+	}
+
+	return results
+}
+
+// flattenRoleMetadata permit to convert metadata to JSON string
+func flattenRoleMetadata(metadata map[string]interface{}) (string, error) {
+	if len(metadata) == 0 {
+		return "{}", nil
+	}
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return "", errors.Wrap(err, "Error when convert metadata to JSON")
+	}
+
+	return string(data), nil
+}
+
 // buildKibanaRoleKibanaFeatures permit to build list of feature map
 func buildKibanaRoleKibanaFeatures(raws []interface{}) map[string][]string {
 	features := map[string][]string{}
 
 	for _, raw := range raws {
 		m := raw.(map[string]interface{})
-		features[m["name"].(string)] = convertArrayInterfaceToArrayString(m["permissions"].(*schema.Set).List())
+		privileges := convertArrayInterfaceToArrayString(m["permissions"].(*schema.Set).List())
+		if subFeaturePrivileges, ok := m["sub_feature_privileges"].(*schema.Set); ok {
+			privileges = append(privileges, convertArrayInterfaceToArrayString(subFeaturePrivileges.List())...)
+		}
+		features[m["name"].(string)] = privileges
 	}
 
 	return features
 }
+
+// isKibanaRolePrimaryFeaturePrivilege return true if the feature privilege is not a sub feature privilege
+func isKibanaRolePrimaryFeaturePrivilege(privilege string) bool {
+	for _, primaryPrivilege := range kibanaRolePrimaryFeaturePrivileges {
+		if privilege == primaryPrivilege {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateKibanaRoleFeatures permit to check at plan time the features and sub feature privileges
+// Sub feature privileges can only be granted with minimal permissions, and they must exist on Kibana features
+func validateKibanaRoleFeatures(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if !d.NewValueKnown("kibana") {
+		return nil
+	}
+
+	features := make([]map[string]interface{}, 0)
+	for _, rawKibana := range d.Get("kibana").(*schema.Set).List() {
+		for _, rawFeature := range rawKibana.(map[string]interface{})["features"].(*schema.Set).List() {
+			feature := rawFeature.(map[string]interface{})
+			if feature["name"].(string) == "" {
+				continue
+			}
+			features = append(features, feature)
+		}
+	}
+	if len(features) == 0 {
+		return nil
+	}
+
+	for _, feature := range features {
+		if feature["sub_feature_privileges"].(*schema.Set).Len() == 0 {
+			continue
+		}
+		for _, permission := range convertArrayInterfaceToArrayString(feature["permissions"].(*schema.Set).List()) {
+			if !strings.HasPrefix(permission, "minimal_") {
+				return errors.Errorf("Feature %s grant sub_feature_privileges, so permissions must be minimal_all or minimal_read, got %s", feature["name"], permission)
+			}
+		}
+	}
+
+	client, err := getClient(ctx, meta.(*ProviderConf))
+	if err != nil {
+		return err
+	}
+	kibanaFeatures, err := getKibanaFeatures(client)
+	if err != nil {
+		log.Warnf("Can't read Kibana features to validate role features: %s", err.Error())
+		return nil
+	}
+
+	for _, feature := range features {
+		name := feature["name"].(string)
+		subFeaturePrivileges, ok := kibanaFeatures[name]
+		if !ok {
+			return errors.Errorf("Feature %s not exist in Kibana", name)
+		}
+		for _, privilege := range convertArrayInterfaceToArrayString(feature["sub_feature_privileges"].(*schema.Set).List()) {
+			if !subFeaturePrivileges[privilege] {
+				return errors.Errorf("Sub feature privilege %s not exist on feature %s in Kibana", privilege, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// getKibanaFeatures return the sub feature privileges of each Kibana feature
+// It's not yet provided by the Kibana client
+func getKibanaFeatures(client *kibana.Client) (map[string]map[string]bool, error) {
+	resp, err := client.Client.R().Get("/api/features")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() >= http.StatusMultipleChoices {
+		return nil, newKibanaError(resp)
+	}
+
+	features := make([]struct {
+		ID          string `json:"id"`
+		SubFeatures []struct {
+			PrivilegeGroups []struct {
+				Privileges []struct {
+					ID string `json:"id"`
+				} `json:"privileges"`
+			} `json:"privilegeGroups"`
+		} `json:"subFeatures"`
+	}, 0)
+	if err = json.Unmarshal(resp.Body(), &features); err != nil {
+		return nil, errors.Wrap(err, "Error when parse Kibana features")
+	}
+
+	results := make(map[string]map[string]bool, len(features))
+	for _, feature := range features {
+		results[feature.ID] = map[string]bool{}
+		for _, subFeature := range feature.SubFeatures {
+			for _, privilegeGroup := range subFeature.PrivilegeGroups {
+				for _, privilege := range privilegeGroup.Privileges {
+					results[feature.ID][privilege.ID] = true
+				}
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// resourceKibanaRoleV0 is the schema of role before field_security is a block
+func resourceKibanaRoleV0() *schema.Resource {
+	stringSet := &schema.Schema{
+		Type:     schema.TypeSet,
+		Optional: true,
+		Elem: &schema.Schema{
+			Type: schema.TypeString,
+		},
+	}
+
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"elasticsearch": {
+				Type:     schema.TypeSet,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"indices": {
+							Type:     schema.TypeSet,
+							Optional: true,
+							Elem: &schema.Resource{
+								Schema: map[string]*schema.Schema{
+									"names":      stringSet,
+									"privileges": stringSet,
+									"query": {
+										Type:     schema.TypeString,
+										Optional: true,
+									},
+									"field_security": {
+										Type:     schema.TypeString,
+										Optional: true,
+									},
+								},
+							},
+						},
+						"cluster": stringSet,
+						"run_as":  stringSet,
+					},
+				},
+			},
+			"kibana": {
+				Type:     schema.TypeSet,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"base":   stringSet,
+						"spaces": stringSet,
+						"features": {
+							Type:     schema.TypeSet,
+							Optional: true,
+							Elem: &schema.Resource{
+								Schema: map[string]*schema.Schema{
+									"name": {
+										Type:     schema.TypeString,
+										Required: true,
+									},
+									"permissions": stringSet,
+								},
+							},
+						},
+					},
+				},
+			},
+			"metadata": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+		},
+	}
+}
+
+// resourceKibanaRoleStateUpgradeV0 permit to convert field_security from JSON string to block
+func resourceKibanaRoleStateUpgradeV0(ctx context.Context, rawState map[string]interface{}, meta interface{}) (map[string]interface{}, error) {
+	elasticsearchs, _ := rawState["elasticsearch"].([]interface{})
+	for _, rawElasticsearch := range elasticsearchs {
+		elasticsearch, _ := rawElasticsearch.(map[string]interface{})
+		indices, _ := elasticsearch["indices"].([]interface{})
+		for _, rawIndice := range indices {
+			indice, ok := rawIndice.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			rawFieldSecurity, _ := indice["field_security"].(string)
+			fieldSecurity, err := optionalMapJSON(rawFieldSecurity)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Error when parse field_security %s", rawFieldSecurity)
+			}
+			indice["field_security"] = flattenKibanaRoleFieldSecurity(fieldSecurity)
+		}
+	}
+
+	return rawState, nil
+}
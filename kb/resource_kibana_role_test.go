@@ -1,11 +1,16 @@
 package kb
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"strings"
 	"testing"
 
-	"github.com/hashicorp/terraform-plugin-sdk/helper/resource"
-	"github.com/hashicorp/terraform-plugin-sdk/terraform"
+	"github.com/ggsood/go-kibana-rest/v7/kbapi"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 	"github.com/pkg/errors"
 )
 
@@ -28,7 +33,7 @@ func TestAccKibanaRole(t *testing.T) {
 				ResourceName:            "kibana_role.test",
 				ImportState:             true,
 				ImportStateVerify:       true,
-				ImportStateVerifyIgnore: []string{"elasticsearch", "kibana", "metadata"},
+				ImportStateVerifyIgnore: []string{},
 			},
 		},
 	})
@@ -46,7 +51,7 @@ func testCheckKibanaRoleExists(name string) resource.TestCheckFunc {
 
 		meta := testAccProvider.Meta()
 
-		client, err := getClient(meta.(*ProviderConf))
+		client, err := getClient(context.Background(), meta.(*ProviderConf))
 		if err != nil {
 			return err
 		}
@@ -70,7 +75,7 @@ func testCheckKibanaRoleDestroy(s *terraform.State) error {
 
 		meta := testAccProvider.Meta()
 
-		client, err := getClient(meta.(*ProviderConf))
+		client, err := getClient(context.Background(), meta.(*ProviderConf))
 		if err != nil {
 			return err
 		}
@@ -116,3 +121,471 @@ resource kibana_role "test" {
   }
 }
 `
+
+func TestKibanaRoleLifecycle(t *testing.T) {
+	for _, version := range testKibanaVersions {
+		t.Run(version, func(t *testing.T) {
+			testKibanaRoleLifecycle(t, version)
+		})
+	}
+}
+
+func testKibanaRoleLifecycle(t *testing.T, version string) {
+	fake := newFakeKibana(t, version)
+	meta := fake.conf()
+	ctx := context.Background()
+	r := resourceKibanaRole()
+
+	d := schema.TestResourceDataRaw(t, r.Schema, map[string]interface{}{
+		"name": "test",
+		"elasticsearch": []interface{}{
+			map[string]interface{}{
+				"cluster": []interface{}{"all"},
+				"indices": []interface{}{
+					map[string]interface{}{
+						"names":      []interface{}{"logstash-*"},
+						"privileges": []interface{}{"read"},
+						"query":      `{"match": {"team": "ops"}}`,
+						"field_security": []interface{}{
+							map[string]interface{}{
+								"grant":  []interface{}{"*"},
+								"except": []interface{}{"secret"},
+							},
+						},
+					},
+				},
+			},
+		},
+		"kibana": []interface{}{
+			map[string]interface{}{
+				"spaces": []interface{}{"default"},
+				"features": []interface{}{
+					map[string]interface{}{
+						"name":        "dashboard",
+						"permissions": []interface{}{"read"},
+					},
+				},
+			},
+		},
+	})
+
+	// Create
+	testCheckDiags(t, r.CreateContext(ctx, d, meta))
+	if d.Id() != "test" || fake.roles["test"] == nil {
+		t.Fatal("Role must be created")
+	}
+	indice := fake.roles["test"]["elasticsearch"].(map[string]interface{})["indices"].([]interface{})[0].(map[string]interface{})
+	if fmt.Sprint(indice["field_security"]) != "map[except:[secret] grant:[*]]" || fmt.Sprint(indice["query"]) != "map[match:map[team:ops]]" {
+		t.Fatalf("Field security and query must be sent as object, got %+v", indice)
+	}
+	indices := d.Get("elasticsearch").(*schema.Set).List()[0].(map[string]interface{})["indices"].(*schema.Set).List()
+	if len(indices) != 1 || indices[0].(map[string]interface{})["field_security"].([]interface{})[0].(map[string]interface{})["except"].(*schema.Set).Len() != 1 {
+		t.Fatalf("Field security must be read, got %+v", indices)
+	}
+
+	// Update
+	d.Set("metadata", `{"team": "ops"}`)
+	testCheckDiags(t, r.UpdateContext(ctx, d, meta))
+	if fake.roles["test"]["metadata"].(map[string]interface{})["team"] != "ops" {
+		t.Fatalf("Role metadata must be updated, got %+v", fake.roles["test"])
+	}
+
+	// Invalid metadata is reported on metadata attribute
+	d.Set("metadata", `{"team": `)
+	diags := r.UpdateContext(ctx, d, meta)
+	if !diags.HasError() || diags[0].AttributePath == nil {
+		t.Fatalf("Invalid metadata must return error on attribute, got %+v", diags)
+	}
+	d.Set("metadata", `{"team": "ops"}`)
+
+	// Kibana error
+	fake.failNext(http.MethodPut, "/api/security/role/test", http.StatusBadRequest, "unknown feature privilege")
+	testCheckDiagsError(t, r.UpdateContext(ctx, d, meta), "unknown feature privilege")
+
+	// Drift when role is deleted outside Terraform
+	delete(fake.roles, "test")
+	testCheckDiagsWarning(t, r.ReadContext(ctx, d, meta))
+	if d.Id() != "" {
+		t.Fatal("Role must be removed from state")
+	}
+
+	// Delete role that not exist anymore
+	d.SetId("test")
+	testCheckDiagsWarning(t, r.DeleteContext(ctx, d, meta))
+	if d.Id() != "" {
+		t.Fatal("Role must be removed from state")
+	}
+}
+
+func TestKibanaRoleValidateQuery(t *testing.T) {
+	r := resourceKibanaRole()
+
+	diags := r.Validate(terraform.NewResourceConfigRaw(map[string]interface{}{
+		"name": "test",
+		"elasticsearch": []interface{}{
+			map[string]interface{}{
+				"indices": []interface{}{
+					map[string]interface{}{
+						"names":      []interface{}{"logstash-*"},
+						"privileges": []interface{}{"read"},
+						"query":      `{"match": `,
+					},
+				},
+			},
+		},
+	}))
+	if !diags.HasError() {
+		t.Fatal("Invalid query must failed at plan time")
+	}
+}
+
+func TestKibanaRoleStateUpgradeV0(t *testing.T) {
+	rawState := map[string]interface{}{
+		"name": "test",
+		"elasticsearch": []interface{}{
+			map[string]interface{}{
+				"indices": []interface{}{
+					map[string]interface{}{
+						"names":          []interface{}{"logstash-*"},
+						"privileges":     []interface{}{"read"},
+						"query":          "{}",
+						"field_security": `{"grant": ["*"], "except": ["secret"]}`,
+					},
+					map[string]interface{}{
+						"names":          []interface{}{"other-*"},
+						"privileges":     []interface{}{"read"},
+						"query":          "{}",
+						"field_security": "{}",
+					},
+				},
+			},
+		},
+	}
+
+	state, err := resourceKibanaRoleStateUpgradeV0(context.Background(), rawState, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indices := state["elasticsearch"].([]interface{})[0].(map[string]interface{})["indices"].([]interface{})
+	if fmt.Sprint(indices[0].(map[string]interface{})["field_security"]) != "[map[except:[secret] grant:[*]]]" {
+		t.Fatalf("Field security must be converted to block, got %+v", indices[0])
+	}
+	if len(indices[1].(map[string]interface{})["field_security"].([]interface{})) != 0 {
+		t.Fatalf("Empty field security must be removed, got %+v", indices[1])
+	}
+
+	rawState["elasticsearch"].([]interface{})[0].(map[string]interface{})["indices"].([]interface{})[0].(map[string]interface{})["field_security"] = `{"grant": `
+	if _, err = resourceKibanaRoleStateUpgradeV0(context.Background(), rawState, nil); err == nil {
+		t.Fatal("Invalid field security must failed")
+	}
+}
+
+func TestFlattenRolesElasticsearch(t *testing.T) {
+	testCases := []struct {
+		name     string
+		role     *kibanaRoleElasticsearch
+		expected string
+	}{
+		{
+			name:     "role without elasticsearch",
+			role:     nil,
+			expected: "[]",
+		},
+		{
+			name:     "elasticsearch without privileges is removed",
+			role:     &kibanaRoleElasticsearch{Indices: []kibanaRoleElasticsearchIndice{}, Cluster: []string{}, RunAs: []string{}},
+			expected: "[]",
+		},
+		{
+			name: "cluster, run_as and indices",
+			role: &kibanaRoleElasticsearch{
+				Cluster: []string{"monitor"},
+				RunAs:   []string{"other"},
+				Indices: []kibanaRoleElasticsearchIndice{
+					{
+						KibanaRoleElasticsearchIndice: kbapi.KibanaRoleElasticsearchIndice{
+							Names:         []string{"logstash-*"},
+							Privileges:    []string{"read"},
+							Query:         `{"match": {"team": "ops"}}`,
+							FieldSecurity: map[string]interface{}{"grant": []interface{}{"*"}, "except": []interface{}{"secret"}},
+						},
+					},
+					{
+						KibanaRoleElasticsearchIndice: kbapi.KibanaRoleElasticsearchIndice{
+							Names:      []string{".security*"},
+							Privileges: []string{"read"},
+							Query:      map[string]interface{}{"match_all": map[string]interface{}{}},
+						},
+						AllowRestrictedIndices: true,
+					},
+				},
+			},
+			expected: `[map[cluster:[monitor] indices:[map[allow_restricted_indices:false field_security:[map[except:[secret] grant:[*]]] names:[logstash-*] privileges:[read] query:{"match": {"team": "ops"}}] map[allow_restricted_indices:true field_security:[] names:[.security*] privileges:[read] query:{"match_all":{}}]] run_as:[other]]]`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		result, err := flattenRolesElasticsearch(testCase.role)
+		if err != nil {
+			t.Fatalf("%s: %s", testCase.name, err)
+		}
+		if fmt.Sprint(result) != testCase.expected {
+			t.Errorf("%s: expected %s, got %s", testCase.name, testCase.expected, fmt.Sprint(result))
+		}
+	}
+}
+
+func TestFlattenRolesKibana(t *testing.T) {
+	result := flattenRolesKibana([]kbapi.KibanaRoleKibana{
+		{
+			Base:   []string{"read"},
+			Spaces: []string{"team-a"},
+		},
+		{
+			Spaces: []string{"default"},
+			Feature: map[string][]string{
+				"discover":  {"read"},
+				"dashboard": {"minimal_read", "url_create"},
+			},
+		},
+	})
+
+	expected := "[map[base:[read] features:[] spaces:[team-a]] map[base:[] features:[map[name:dashboard permissions:[minimal_read] sub_feature_privileges:[url_create]] map[name:discover permissions:[read] sub_feature_privileges:[]]] spaces:[default]]]"
+	if fmt.Sprint(result) != expected {
+		t.Errorf("Expected %s, got %s", expected, fmt.Sprint(result))
+	}
+
+	if len(flattenRolesKibana(nil)) != 0 {
+		t.Error("Role without kibana privileges must be empty")
+	}
+}
+
+func TestFlattenRoleMetadata(t *testing.T) {
+	for _, metadata := range []map[string]interface{}{nil, {}} {
+		result, err := flattenRoleMetadata(metadata)
+		if err != nil || result != "{}" {
+			t.Errorf("Empty metadata must be flatten as empty JSON object, got %s", result)
+		}
+	}
+
+	result, err := flattenRoleMetadata(map[string]interface{}{"team": "ops", "version": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != `{"team":"ops","version":1}` {
+		t.Errorf("Metadata must be flatten as JSON, got %s", result)
+	}
+}
+
+func TestKibanaRoleImport(t *testing.T) {
+	fake := newFakeKibana(t, "7.10.2")
+	meta := fake.conf()
+	ctx := context.Background()
+	r := resourceKibanaRole()
+
+	raw := map[string]interface{}{
+		"name":     "test",
+		"metadata": `{"team": "ops"}`,
+		"elasticsearch": []interface{}{
+			map[string]interface{}{
+				"cluster": []interface{}{"monitor"},
+				"indices": []interface{}{
+					map[string]interface{}{
+						"names":      []interface{}{"logstash-*"},
+						"privileges": []interface{}{"read"},
+						"field_security": []interface{}{
+							map[string]interface{}{
+								"grant": []interface{}{"*"},
+							},
+						},
+					},
+				},
+			},
+		},
+		"kibana": []interface{}{
+			map[string]interface{}{
+				"spaces": []interface{}{"default"},
+				"features": []interface{}{
+					map[string]interface{}{
+						"name":        "dashboard",
+						"permissions": []interface{}{"read"},
+					},
+				},
+			},
+		},
+	}
+	d := schema.TestResourceDataRaw(t, r.Schema, raw)
+	testCheckDiags(t, r.CreateContext(ctx, d, meta))
+
+	// Imported role has no diff with configuration
+	imported := r.Data(nil)
+	imported.SetId("test")
+	testCheckDiags(t, r.ReadContext(ctx, imported, meta))
+	diff, err := r.Diff(ctx, imported.State(), terraform.NewResourceConfigRaw(raw), meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff != nil && !diff.Empty() {
+		t.Fatalf("Imported role must not drift, got %+v", diff)
+	}
+
+	// Role without elasticsearch privileges
+	delete(raw, "elasticsearch")
+	d = schema.TestResourceDataRaw(t, r.Schema, raw)
+	d.SetId("test")
+	testCheckDiags(t, r.UpdateContext(ctx, d, meta))
+	fake.roles["test"]["elasticsearch"] = map[string]interface{}{"cluster": []interface{}{}, "indices": []interface{}{}, "run_as": []interface{}{}}
+	testCheckDiags(t, r.ReadContext(ctx, d, meta))
+	if d.Get("elasticsearch").(*schema.Set).Len() != 0 {
+		t.Fatalf("Empty elasticsearch privileges must not be read, got %+v", d.Get("elasticsearch"))
+	}
+}
+
+func TestKibanaRoleRestrictedIndicesAndSubFeatures(t *testing.T) {
+	fake := newFakeKibana(t, "7.10.2")
+	meta := fake.conf()
+	ctx := context.Background()
+	r := resourceKibanaRole()
+
+	raw := map[string]interface{}{
+		"name": "test",
+		"elasticsearch": []interface{}{
+			map[string]interface{}{
+				"indices": []interface{}{
+					map[string]interface{}{
+						"names":                    []interface{}{".security*"},
+						"privileges":               []interface{}{"read"},
+						"allow_restricted_indices": true,
+					},
+				},
+			},
+		},
+		"kibana": []interface{}{
+			map[string]interface{}{
+				"spaces": []interface{}{"default"},
+				"features": []interface{}{
+					map[string]interface{}{
+						"name":                   "dashboard",
+						"permissions":            []interface{}{"minimal_read"},
+						"sub_feature_privileges": []interface{}{"url_create"},
+					},
+				},
+			},
+		},
+	}
+
+	// Plan
+	if _, err := r.Diff(ctx, nil, terraform.NewResourceConfigRaw(raw), meta); err != nil {
+		t.Fatal(err)
+	}
+
+	// Create
+	d := schema.TestResourceDataRaw(t, r.Schema, raw)
+	testCheckDiags(t, r.CreateContext(ctx, d, meta))
+	indice := fake.roles["test"]["elasticsearch"].(map[string]interface{})["indices"].([]interface{})[0].(map[string]interface{})
+	if indice["allow_restricted_indices"] != true {
+		t.Fatalf("allow_restricted_indices must be sent, got %+v", indice)
+	}
+	feature := fake.roles["test"]["kibana"].([]interface{})[0].(map[string]interface{})["feature"].(map[string]interface{})
+	if fmt.Sprint(feature["dashboard"]) != "[minimal_read url_create]" {
+		t.Fatalf("Sub feature privileges must be sent with feature privileges, got %+v", feature)
+	}
+
+	// Imported role has no diff with configuration
+	imported := r.Data(nil)
+	imported.SetId("test")
+	testCheckDiags(t, r.ReadContext(ctx, imported, meta))
+	diff, err := r.Diff(ctx, imported.State(), terraform.NewResourceConfigRaw(raw), meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff != nil && !diff.Empty() {
+		t.Fatalf("Imported role must not drift, got %+v", diff)
+	}
+}
+
+func TestKibanaRoleValidateFeatures(t *testing.T) {
+	fake := newFakeKibana(t, "7.10.2")
+	meta := fake.conf()
+	ctx := context.Background()
+	r := resourceKibanaRole()
+
+	testCases := []struct {
+		name                 string
+		feature              string
+		permissions          []interface{}
+		subFeaturePrivileges []interface{}
+		expected             string
+	}{
+		{
+			name:        "feature without sub feature privileges",
+			feature:     "discover",
+			permissions: []interface{}{"all"},
+		},
+		{
+			name:                 "sub feature privileges need minimal permissions",
+			feature:              "dashboard",
+			permissions:          []interface{}{"read"},
+			subFeaturePrivileges: []interface{}{"url_create"},
+			expected:             "minimal_all or minimal_read",
+		},
+		{
+			name:                 "sub feature privilege not exist",
+			feature:              "discover",
+			permissions:          []interface{}{"minimal_read"},
+			subFeaturePrivileges: []interface{}{"url_create"},
+			expected:             "Sub feature privilege url_create not exist on feature discover",
+		},
+		{
+			name:                 "feature not exist",
+			feature:              "unknown",
+			permissions:          []interface{}{"minimal_read"},
+			subFeaturePrivileges: []interface{}{"url_create"},
+			expected:             "Feature unknown not exist",
+		},
+	}
+
+	for _, testCase := range testCases {
+		raw := map[string]interface{}{
+			"name": "test",
+			"kibana": []interface{}{
+				map[string]interface{}{
+					"spaces": []interface{}{"default"},
+					"features": []interface{}{
+						map[string]interface{}{
+							"name":                   testCase.feature,
+							"permissions":            testCase.permissions,
+							"sub_feature_privileges": testCase.subFeaturePrivileges,
+						},
+					},
+				},
+			},
+		}
+		_, err := r.Diff(ctx, nil, terraform.NewResourceConfigRaw(raw), meta)
+		if testCase.expected == "" && err != nil {
+			t.Errorf("%s: unexpected error %s", testCase.name, err)
+		}
+		if testCase.expected != "" && (err == nil || !strings.Contains(err.Error(), testCase.expected)) {
+			t.Errorf("%s: expected error %q, got %v", testCase.name, testCase.expected, err)
+		}
+	}
+
+	// Sub feature privilege can't be set on permissions
+	diags := r.Validate(terraform.NewResourceConfigRaw(map[string]interface{}{
+		"name": "test",
+		"kibana": []interface{}{
+			map[string]interface{}{
+				"spaces": []interface{}{"default"},
+				"features": []interface{}{
+					map[string]interface{}{
+						"name":        "dashboard",
+						"permissions": []interface{}{"url_create"},
+					},
+				},
+			},
+		},
+	}))
+	if !diags.HasError() {
+		t.Fatal("Sub feature privilege on permissions must failed")
+	}
+}
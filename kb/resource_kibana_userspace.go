@@ -2,28 +2,42 @@
 // API documentation: https://www.elastic.co/guide/en/kibana/master/spaces-api.html
 // Supported version:
 //  - v7
+//  - v8
 
 package kb
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	kbapi "github.com/ggsood/go-kibana-rest/v7/kbapi"
 
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	log "github.com/sirupsen/logrus"
 )
 
 // Resource specification to handle user space in Kibana
 func resourceKibanaUserSpace() *schema.Resource {
 	return &schema.Resource{
-		Create: resourceKibanaUserSpaceCreate,
-		Read:   resourceKibanaUserSpaceRead,
-		Update: resourceKibanaUserSpaceUpdate,
-		Delete: resourceKibanaUserSpaceDelete,
+		CreateContext: resourceKibanaUserSpaceCreate,
+		ReadContext:   resourceKibanaUserSpaceRead,
+		UpdateContext: resourceKibanaUserSpaceUpdate,
+		DeleteContext: resourceKibanaUserSpaceDelete,
+
+		CustomizeDiff: checkKibanaCapabilities("kibana_user_space"),
 
 		Importer: &schema.ResourceImporter{
-			State: schema.ImportStatePassthrough,
+			StateContext: schema.ImportStatePassthroughContext,
+		},
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Read:   schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
 		},
 
 		Schema: map[string]*schema.Schema{
@@ -56,16 +70,16 @@ func resourceKibanaUserSpace() *schema.Resource {
 }
 
 // Create new user space in Kibana
-func resourceKibanaUserSpaceCreate(d *schema.ResourceData, meta interface{}) error {
+func resourceKibanaUserSpaceCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	name := d.Get("name").(string)
 	description := d.Get("description").(string)
 	disabledFeatures := convertArrayInterfaceToArrayString(d.Get("disabled_features").(*schema.Set).List())
 	initials := d.Get("initials").(string)
 	color := d.Get("color").(string)
 
-	client, err := getClient(meta.(*ProviderConf))
+	client, err := getClient(ctx, meta.(*ProviderConf))
 	if err != nil {
-		return err
+		return diagFromKibanaError(err)
 	}
 
 	userSpace := &kbapi.KibanaSpace{
@@ -79,38 +93,37 @@ func resourceKibanaUserSpaceCreate(d *schema.ResourceData, meta interface{}) err
 
 	_, err = client.API.KibanaSpaces.Create(userSpace)
 	if err != nil {
-		return err
+		return diagFromKibanaError(err)
 	}
 
 	d.SetId(name)
 
 	log.Infof("Created user space %s successfully", name)
 
-	return resourceKibanaUserSpaceRead(d, meta)
+	return resourceKibanaUserSpaceRead(ctx, d, meta)
 }
 
 // Read existing user space in Kibana
-func resourceKibanaUserSpaceRead(d *schema.ResourceData, meta interface{}) error {
+func resourceKibanaUserSpaceRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 
 	id := d.Id()
 
 	log.Debugf("User space id:  %s", id)
 
-	client, err := getClient(meta.(*ProviderConf))
+	client, err := getClient(ctx, meta.(*ProviderConf))
 	if err != nil {
-		return err
+		return diagFromKibanaError(err)
 	}
 
 	userSpace, err := client.API.KibanaSpaces.Get(id)
 	if err != nil {
-		return err
+		return diagFromKibanaError(err)
 	}
 
 	if userSpace == nil {
-		fmt.Printf("[WARN] User space %s not found - removing from state", id)
 		log.Warnf("User space %s not found - removing from state", id)
 		d.SetId("")
-		return nil
+		return diagWarning("User space %s not found - removing from state", id)
 	}
 
 	log.Debugf("Get user space %s successfully:\n%s", id, userSpace)
@@ -127,16 +140,16 @@ func resourceKibanaUserSpaceRead(d *schema.ResourceData, meta interface{}) error
 }
 
 // Update existing user space in Elasticsearch
-func resourceKibanaUserSpaceUpdate(d *schema.ResourceData, meta interface{}) error {
+func resourceKibanaUserSpaceUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	id := d.Id()
 	description := d.Get("description").(string)
 	disabledFeatures := convertArrayInterfaceToArrayString(d.Get("disabled_features").(*schema.Set).List())
 	initials := d.Get("initials").(string)
 	color := d.Get("color").(string)
 
-	client, err := getClient(meta.(*ProviderConf))
+	client, err := getClient(ctx, meta.(*ProviderConf))
 	if err != nil {
-		return err
+		return diagFromKibanaError(err)
 	}
 
 	userSpace := &kbapi.KibanaSpace{
@@ -150,35 +163,49 @@ func resourceKibanaUserSpaceUpdate(d *schema.ResourceData, meta interface{}) err
 
 	_, err = client.API.KibanaSpaces.Update(userSpace)
 	if err != nil {
-		return err
+		return diagFromKibanaError(err)
 	}
 
 	log.Infof("Updated user space %s successfully", id)
 
-	return resourceKibanaUserSpaceRead(d, meta)
+	return resourceKibanaUserSpaceRead(ctx, d, meta)
 }
 
 // Delete existing role in Elasticsearch
-func resourceKibanaUserSpaceDelete(d *schema.ResourceData, meta interface{}) error {
+func resourceKibanaUserSpaceDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 
 	id := d.Id()
 	log.Debugf("User space id: %s", id)
 
-	client, err := getClient(meta.(*ProviderConf))
+	client, err := getClient(ctx, meta.(*ProviderConf))
 	if err != nil {
-		return err
+		return diagFromKibanaError(err)
 	}
 
 	err = client.API.KibanaSpaces.Delete(id)
 	if err != nil {
-		if err.(kbapi.APIError).Code == 404 {
-			fmt.Printf("[WARN] User space %s not found - removing from state", id)
+		if isNotFoundError(err) {
 			log.Warnf("User space %s not found - removing from state", id)
 			d.SetId("")
-			return nil
+			return diagWarning("User space %s not found - removing from state", id)
 		}
-		return err
+		return diagFromKibanaError(err)
+
+	}
 
+	// Kibana delete the space objects asynchronously, so we wait the space is really removed
+	err = resource.RetryContext(ctx, d.Timeout(schema.TimeoutDelete), func() *resource.RetryError {
+		userSpace, err := client.API.KibanaSpaces.Get(id)
+		if err != nil {
+			return resource.NonRetryableError(err)
+		}
+		if userSpace != nil {
+			return resource.RetryableError(fmt.Errorf("User space %s is still being deleted", id))
+		}
+		return nil
+	})
+	if err != nil {
+		return diagFromKibanaError(err)
 	}
 
 	d.SetId("")
@@ -1,11 +1,14 @@
 package kb
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"testing"
 
-	"github.com/hashicorp/terraform-plugin-sdk/helper/resource"
-	"github.com/hashicorp/terraform-plugin-sdk/terraform"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 	"github.com/pkg/errors"
 )
 
@@ -46,7 +49,7 @@ func testCheckKibanaUserSpaceExists(name string) resource.TestCheckFunc {
 
 		meta := testAccProvider.Meta()
 
-		client, err := getClient(meta.(*ProviderConf))
+		client, err := getClient(context.Background(), meta.(*ProviderConf))
 		if err != nil {
 			return err
 		}
@@ -70,7 +73,7 @@ func testCheckKibanaUserSpaceDestroy(s *terraform.State) error {
 
 		meta := testAccProvider.Meta()
 
-		client, err := getClient(meta.(*ProviderConf))
+		client, err := getClient(context.Background(), meta.(*ProviderConf))
 		if err != nil {
 			return err
 		}
@@ -97,3 +100,60 @@ resource "kibana_user_space" "test" {
   disabled_features = ["canvas", "maps", "advancedSettings", "indexPatterns", "graph", "monitoring", "ml", "apm", "infrastructure", "logs", "siem"]
 }
 `
+
+func TestKibanaUserSpaceLifecycle(t *testing.T) {
+	for _, version := range testKibanaVersions {
+		t.Run(version, func(t *testing.T) {
+			testKibanaUserSpaceLifecycle(t, version)
+		})
+	}
+}
+
+func testKibanaUserSpaceLifecycle(t *testing.T, version string) {
+	fake := newFakeKibana(t, version)
+	meta := fake.conf()
+	ctx := context.Background()
+	r := resourceKibanaUserSpace()
+
+	d := schema.TestResourceDataRaw(t, r.Schema, map[string]interface{}{
+		"name":              "test",
+		"description":       "test",
+		"disabled_features": []interface{}{"canvas"},
+	})
+
+	// Create
+	testCheckDiags(t, r.CreateContext(ctx, d, meta))
+	if d.Id() != "test" || fake.spaces["test"] == nil {
+		t.Fatal("User space must be created")
+	}
+
+	// Create when user space already exist
+	fake.failNext(http.MethodPost, "/api/spaces/space", http.StatusConflict, "A space with the identifier test already exists.")
+	diags := r.CreateContext(ctx, d, meta)
+	testCheckDiagsError(t, diags, "already exists")
+	if diags[0].Detail == "" {
+		t.Error("Conflict error must provide hint")
+	}
+
+	// Update
+	d.Set("description", "updated")
+	testCheckDiags(t, r.UpdateContext(ctx, d, meta))
+	if fake.spaces["test"].Description != "updated" {
+		t.Fatal("User space must be updated")
+	}
+
+	// Drift when user space is deleted outside Terraform
+	delete(fake.spaces, "test")
+	testCheckDiagsWarning(t, r.ReadContext(ctx, d, meta))
+	if d.Id() != "" {
+		t.Fatal("User space must be removed from state")
+	}
+
+	// Delete
+	d.SetId("test")
+	testCheckDiags(t, r.CreateContext(ctx, d, meta))
+	testCheckDiags(t, r.DeleteContext(ctx, d, meta))
+	if d.Id() != "" || fake.spaces["test"] != nil {
+		t.Fatal("User space must be deleted")
+	}
+}
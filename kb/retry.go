@@ -0,0 +1,180 @@
+package kb
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// retryPolicy is the retry policy applied on all API calls
+type retryPolicy struct {
+	MaxRetry       int
+	WaitTime       time.Duration
+	MaxWaitTime    time.Duration
+	MaxElapsedTime time.Duration
+}
+
+// retryTransport is HTTP transport that retry API calls with exponential backoff and jitter
+// when Kibana is not reachable or return transient error
+type retryTransport struct {
+	transport http.RoundTripper
+	policy    retryPolicy
+}
+
+// newRetryTransport permit to wrap transport with retry policy
+func newRetryTransport(transport http.RoundTripper, policy retryPolicy) *retryTransport {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	return &retryTransport{
+		transport: transport,
+		policy:    policy,
+	}
+}
+
+// RoundTrip execute HTTP request and retry it as long as the policy permit it
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	startTime := time.Now()
+
+	for attempt := 0; ; attempt++ {
+		resp, err := t.transport.RoundTrip(req)
+		if req.Context().Err() != nil || !isRetryableResponse(req, resp, err) || attempt >= t.policy.MaxRetry {
+			return resp, err
+		}
+
+		// Request body was consumed by this attempt and can't be sent again
+		if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+			return resp, err
+		}
+
+		waitTime := t.policy.backoff(attempt, resp)
+		if t.policy.MaxElapsedTime > 0 && time.Since(startTime)+waitTime > t.policy.MaxElapsedTime {
+			return resp, err
+		}
+
+		// Not wait if the next attempt can't be done before the resource timeout
+		if deadline, ok := req.Context().Deadline(); ok && time.Until(deadline) < waitTime {
+			return resp, err
+		}
+
+		if err != nil {
+			log.Warnf("Request %s %s failed: %s, retry in %s", req.Method, req.URL.Path, err.Error(), waitTime)
+		} else {
+			log.Warnf("Request %s %s failed with status %d, retry in %s", req.Method, req.URL.Path, resp.StatusCode, waitTime)
+			drainBody(resp.Body)
+		}
+
+		timer := time.NewTimer(waitTime)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		if req.Body != nil && req.Body != http.NoBody {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+// backoff compute the wait time before next attempt
+// It use capped exponential backoff with jitter, or Retry-After header when Kibana provide it
+func (p *retryPolicy) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			waitTime := time.Duration(seconds) * time.Second
+			if p.MaxWaitTime > 0 && waitTime > p.MaxWaitTime {
+				return p.MaxWaitTime
+			}
+			return waitTime
+		}
+	}
+
+	waitTime := float64(p.WaitTime) * math.Exp2(float64(attempt))
+	if p.MaxWaitTime > 0 {
+		waitTime = math.Min(waitTime, float64(p.MaxWaitTime))
+	}
+
+	// Wait between half and full backoff time to avoid retry at the same time
+	half := int64(waitTime / 2)
+	if half <= 0 {
+		return time.Duration(waitTime)
+	}
+	return time.Duration(half + rand.Int63n(half))
+}
+
+// isRetryableResponse return true if request failed with transient error
+// It's the case for network error, too many request and when Kibana or a proxy is unavailable
+// Request that is not idempotent, like POST, is only retried when Kibana has not processed it:
+// the connection can't be established, or Kibana reject it with 429 or 503
+func isRetryableResponse(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		if isCertificateError(err) {
+			return false
+		}
+		if !isIdempotentRequest(req) {
+			return isConnectionError(err)
+		}
+		return true
+	}
+
+	if !isIdempotentRequest(req) {
+		return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable
+	}
+
+	return isTransientStatusCode(resp.StatusCode)
+}
+
+// isIdempotentRequest return true if the request can be sent many times with the same effect
+func isIdempotentRequest(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// isConnectionError return true if the connection to Kibana can't be established, so the request was not sent
+func isConnectionError(err error) bool {
+	var opError *net.OpError
+	return errors.As(err, &opError) && opError.Op == "dial"
+}
+
+// isCertificateError return true if TLS handshake failed, retry can't solve it
+func isCertificateError(err error) bool {
+	var unknownAuthorityError x509.UnknownAuthorityError
+	var certificateInvalidError x509.CertificateInvalidError
+	var hostnameError x509.HostnameError
+	var recordHeaderError tls.RecordHeaderError
+
+	return errors.As(err, &unknownAuthorityError) ||
+		errors.As(err, &certificateInvalidError) ||
+		errors.As(err, &hostnameError) ||
+		errors.As(err, &recordHeaderError)
+}
+
+// drainBody permit to read and close response body, so the connection can be reused
+func drainBody(body io.ReadCloser) {
+	if body == nil {
+		return
+	}
+	io.Copy(ioutil.Discard, body)
+	body.Close()
+}
@@ -0,0 +1,203 @@
+package kb
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryTransport(t *testing.T) {
+	nbCall := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nbCall++
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != "test" {
+			t.Errorf("Request body must be replayed on each attempt, got %q", string(body))
+		}
+		if nbCall < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: newRetryTransport(nil, retryPolicy{
+			MaxRetry: 3,
+			WaitTime: time.Millisecond,
+		}),
+	}
+
+	resp, err := client.Post(server.URL, "text/plain", bytes.NewBufferString("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Request must succeed after retry, got status %d", resp.StatusCode)
+	}
+	if nbCall != 3 {
+		t.Fatalf("Request must be sent 3 times, got %d", nbCall)
+	}
+}
+
+func TestRetryTransportNotRetryable(t *testing.T) {
+	nbCall := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nbCall++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: newRetryTransport(nil, retryPolicy{
+			MaxRetry: 3,
+			WaitTime: time.Millisecond,
+		}),
+	}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusBadRequest || nbCall != 1 {
+		t.Fatalf("Bad request must not be retried, got status %d after %d calls", resp.StatusCode, nbCall)
+	}
+}
+
+func TestRetryTransportNotIdempotent(t *testing.T) {
+	nbCall := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nbCall++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: newRetryTransport(nil, retryPolicy{
+			MaxRetry: 3,
+			WaitTime: time.Millisecond,
+		}),
+	}
+
+	// Kibana may have processed the POST request behind the proxy
+	resp, err := client.Post(server.URL, "text/plain", bytes.NewBufferString("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusBadGateway || nbCall != 1 {
+		t.Fatalf("POST request must not be retried on bad gateway, got status %d after %d calls", resp.StatusCode, nbCall)
+	}
+
+	// Idempotent request is retried
+	nbCall = 0
+	if _, err = client.Get(server.URL); err != nil {
+		t.Fatal(err)
+	}
+	if nbCall != 4 {
+		t.Fatalf("GET request must be retried on bad gateway, got %d calls", nbCall)
+	}
+}
+
+func TestRetryTransportWithoutGetBody(t *testing.T) {
+	nbCall := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nbCall++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: newRetryTransport(nil, retryPolicy{
+			MaxRetry: 3,
+			WaitTime: time.Millisecond,
+		}),
+	}
+
+	// Body that can't be read again
+	req, _ := http.NewRequest(http.MethodPut, server.URL, ioutil.NopCloser(strings.NewReader("test")))
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable || nbCall != 1 {
+		t.Fatalf("Request without GetBody must return the first response, got status %d after %d calls", resp.StatusCode, nbCall)
+	}
+}
+
+func TestIsRetryableResponseError(t *testing.T) {
+	post, _ := http.NewRequest(http.MethodPost, "http://localhost:5601", nil)
+	get, _ := http.NewRequest(http.MethodGet, "http://localhost:5601", nil)
+
+	dialError := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	readError := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+	certificateError := &url.Error{Op: "Get", URL: "https://localhost:5601", Err: x509.UnknownAuthorityError{}}
+
+	if !isRetryableResponse(post, nil, dialError) || !isRetryableResponse(get, nil, dialError) {
+		t.Error("Request must be retried when connection can't be established")
+	}
+	if isRetryableResponse(post, nil, readError) || !isRetryableResponse(get, nil, readError) {
+		t.Error("Only idempotent request must be retried when connection is lost")
+	}
+	if isRetryableResponse(get, nil, certificateError) {
+		t.Error("Request must not be retried on certificate error")
+	}
+	if !isRetryableResponse(post, &http.Response{StatusCode: http.StatusTooManyRequests}, nil) || isRetryableResponse(post, &http.Response{StatusCode: http.StatusGatewayTimeout}, nil) {
+		t.Error("POST request must only be retried on 429 and 503")
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := retryPolicy{
+		WaitTime:    time.Second,
+		MaxWaitTime: 4 * time.Second,
+	}
+
+	for attempt, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		waitTime := policy.backoff(attempt, nil)
+		if waitTime < max/2 || waitTime > max {
+			t.Errorf("Wait time for attempt %d must be between %s and %s, got %s", attempt, max/2, max, waitTime)
+		}
+	}
+
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{"3"}}}
+	if waitTime := policy.backoff(0, resp); waitTime != 3*time.Second {
+		t.Errorf("Wait time must use Retry-After header, got %s", waitTime)
+	}
+}
+
+func TestRetryTransportDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: newRetryTransport(nil, retryPolicy{
+			MaxRetry: 3,
+			WaitTime: 10 * time.Second,
+		}),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+
+	startTime := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable || time.Since(startTime) > 5*time.Second {
+		t.Fatal("Request must not wait retry after the deadline")
+	}
+}
@@ -0,0 +1,559 @@
+package kb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	kibana "github.com/ggsood/go-kibana-rest/v7"
+	"github.com/ggsood/go-kibana-rest/v7/kbapi"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// parseSavedObjects permit to extract the type and id of each saved object from NDJSON data
+// Empty lines and the export summary line are skipped
+func parseSavedObjects(data string) ([]map[string]string, error) {
+	objects := make([]map[string]string, 0)
+
+	for i, line := range strings.Split(data, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		object := struct {
+			ID   string `json:"id"`
+			Type string `json:"type"`
+		}{}
+		if err := json.Unmarshal([]byte(line), &object); err != nil {
+			return nil, errors.Wrapf(err, "Error when parse line %d of saved objects", i+1)
+		}
+
+		// The export summary line has no type and id
+		if object.ID == "" && object.Type == "" {
+			continue
+		}
+		if object.ID == "" || object.Type == "" {
+			return nil, errors.Errorf("Saved object on line %d must have id and type", i+1)
+		}
+
+		objects = append(objects, map[string]string{
+			"id":   object.ID,
+			"type": object.Type,
+		})
+	}
+
+	return objects, nil
+}
+
+// savedObjectImportResponse is the response of saved objects import API
+// It's also the response for each space of copy saved objects API
+type savedObjectImportResponse struct {
+	Success        bool                 `json:"success"`
+	SuccessCount   int                  `json:"successCount"`
+	SuccessResults []savedObjectSuccess `json:"successResults"`
+	Errors         []savedObjectError   `json:"errors"`
+}
+
+// savedObjectSuccess is the saved object successfully imported or copied
+// DestinationID is only provided when the object is created with a new id
+type savedObjectSuccess struct {
+	Type          string `json:"type"`
+	ID            string `json:"id"`
+	DestinationID string `json:"destinationId,omitempty"`
+}
+
+// savedObjectError is the error returned by Kibana for one saved object that can't be imported or copied
+// When the error is not related to an object, like space not found, only the message is provided
+type savedObjectError struct {
+	ID      string                 `json:"id"`
+	Type    string                 `json:"type"`
+	Title   string                 `json:"title"`
+	Message string                 `json:"message"`
+	Error   savedObjectErrorDetail `json:"error"`
+}
+
+// savedObjectErrorDetail is the reason why saved object can't be imported or copied
+type savedObjectErrorDetail struct {
+	Type          string              `json:"type"`
+	Message       string              `json:"message"`
+	DestinationID string              `json:"destinationId"`
+	References    []map[string]string `json:"references"`
+}
+
+// UnmarshalJSON permit to read error detail, that is only the error name when the error is not related to an object
+func (e *savedObjectErrorDetail) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		e.Type = name
+		return nil
+	}
+
+	type detail savedObjectErrorDetail
+	return json.Unmarshal(b, (*detail)(e))
+}
+
+// savedObjectImportRetry is the resolution to apply on saved object that failed to import
+type savedObjectImportRetry struct {
+	Type              string                        `json:"type"`
+	ID                string                        `json:"id"`
+	Overwrite         bool                          `json:"overwrite"`
+	ReplaceReferences []savedObjectReplaceReference `json:"replaceReferences"`
+}
+
+// savedObjectReplaceReference is the reference to replace when retry saved object import
+type savedObjectReplaceReference struct {
+	Type string `json:"type"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// parseImportResponse permit to convert the raw response of saved objects import API
+func parseImportResponse(raw map[string]interface{}) (*savedObjectImportResponse, error) {
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &savedObjectImportResponse{}
+	if err = json.Unmarshal(b, response); err != nil {
+		return nil, errors.Wrap(err, "Error when parse import response")
+	}
+
+	return response, nil
+}
+
+// diagFromSavedObjectErrors return one error diagnostic per saved object that Kibana failed to import or copy
+// The space is added to the message when it's not empty
+func diagFromSavedObjectErrors(action string, space string, objectErrors []savedObjectError) diag.Diagnostics {
+	var inSpace string
+	if space != "" {
+		inSpace = fmt.Sprintf(" in space %s", space)
+	}
+
+	if len(objectErrors) == 0 {
+		return diag.Errorf("Kibana failed to %s saved objects%s without providing errors", action, inSpace)
+	}
+
+	diags := make(diag.Diagnostics, 0, len(objectErrors))
+	for _, objectError := range objectErrors {
+		if objectError.ID == "" && objectError.Type == "" {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Error,
+				Summary:  fmt.Sprintf("Failed to %s saved objects%s: %s", action, inSpace, objectError.Error.Type),
+				Detail:   objectError.Message,
+			})
+			continue
+		}
+
+		summary := fmt.Sprintf("Failed to %s %s %s", action, objectError.Type, objectError.ID)
+		if objectError.Title != "" {
+			summary = fmt.Sprintf("%s (%s)", summary, objectError.Title)
+		}
+		summary = fmt.Sprintf("%s%s: %s", summary, inSpace, objectError.Error.Type)
+
+		var detail string
+		switch objectError.Error.Type {
+		case "missing_references":
+			references := make([]string, len(objectError.Error.References))
+			for i, reference := range objectError.Error.References {
+				references[i] = fmt.Sprintf("%s %s", reference["type"], reference["id"])
+			}
+			detail = fmt.Sprintf("Missing references: %s", strings.Join(references, ", "))
+		case "conflict", "ambiguous_conflict":
+			detail = "The object already exists in the space"
+		case "unsupported_type":
+			detail = "The object type is not supported by Kibana"
+		default:
+			detail = objectError.Error.Message
+		}
+
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Error,
+			Summary:  summary,
+			Detail:   detail,
+		})
+	}
+
+	return diags
+}
+
+// resolveImportErrors permit to retry the import of saved objects with resolve import errors API
+// It's not yet provided by the Kibana client
+func resolveImportErrors(client *kibana.Client, data []byte, retries []savedObjectImportRetry, space string) (*savedObjectImportResponse, error) {
+	retriesJSON, err := json.Marshal(retries)
+	if err != nil {
+		return nil, err
+	}
+
+	path := spacePath(space, "/api/saved_objects/_resolve_import_errors")
+	log.Debugf("URL to resolve import errors: %s", path)
+	log.Debugf("Retries: %s", retriesJSON)
+
+	resp, err := client.Client.R().
+		SetFileReader("file", "file.ndjson", bytes.NewReader(data)).
+		SetFormData(map[string]string{"retries": string(retriesJSON)}).
+		Post(path)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() >= http.StatusMultipleChoices {
+		return nil, newKibanaError(resp)
+	}
+	log.Debugf("Response: %s", resp.Body())
+
+	response := &savedObjectImportResponse{}
+	if err = json.Unmarshal(resp.Body(), response); err != nil {
+		return nil, errors.Wrap(err, "Error when parse resolve import errors response")
+	}
+
+	return response, nil
+}
+
+// parseObjectsID permit to parse list of saved objects like type:id,type:id
+// It's used to import resources that manage saved objects
+func parseObjectsID(raw string) ([]map[string]string, error) {
+	objects := make([]map[string]string, 0)
+
+	for _, rawObject := range strings.Split(raw, ",") {
+		parts := strings.SplitN(rawObject, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.Errorf("Object %q must be formated as type:id", rawObject)
+		}
+
+		objects = append(objects, map[string]string{
+			"type": parts[0],
+			"id":   parts[1],
+		})
+	}
+
+	return objects, nil
+}
+
+// defaultIgnoredFields is the list of saved object fields that Kibana change on each import or export
+// Kibana 8 also add managed on all saved objects
+var defaultIgnoredFields = []string{
+	"version",
+	"updated_at",
+	"migrationVersion",
+	"coreMigrationVersion",
+	"typeMigrationVersion",
+	"namespaces",
+	"managed",
+}
+
+// normalizeSavedObjects permit to convert NDJSON data to saved objects keyed by type and id
+// The export summary line and the ignored fields are removed, and references are sorted, so two exports of the same objects are equal
+// Ignored fields can target nested field with dot notation, like attributes.description
+func normalizeSavedObjects(data string, ignoredFields []string) (map[string]map[string]interface{}, error) {
+	objects := map[string]map[string]interface{}{}
+
+	for i, line := range strings.Split(data, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		object := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &object); err != nil {
+			return nil, errors.Wrapf(err, "Error when parse line %d of saved objects", i+1)
+		}
+
+		// The export summary line has no type and id
+		objectType, _ := object["type"].(string)
+		id, _ := object["id"].(string)
+		if objectType == "" && id == "" {
+			continue
+		}
+		if objectType == "" || id == "" {
+			return nil, errors.Errorf("Saved object on line %d must have id and type", i+1)
+		}
+
+		for _, field := range ignoredFields {
+			deleteField(object, strings.Split(field, "."))
+		}
+		if references, ok := object["references"].([]interface{}); ok {
+			sortReferences(references)
+		}
+
+		objects[savedObjectKey(objectType, id)] = object
+	}
+
+	return objects, nil
+}
+
+// savedObjectKey return the unique key of saved object in a space
+func savedObjectKey(objectType string, id string) string {
+	return objectType + "/" + id
+}
+
+// deleteField permit to remove field from object, following the path on nested objects
+func deleteField(object map[string]interface{}, path []string) {
+	if len(path) == 1 {
+		delete(object, path[0])
+		return
+	}
+
+	if nested, ok := object[path[0]].(map[string]interface{}); ok {
+		deleteField(nested, path[1:])
+	}
+}
+
+// sortReferences permit to sort references of saved object by name, type and id
+// Kibana not guarantee the references order
+func sortReferences(references []interface{}) {
+	keys := make([]string, len(references))
+	for i, reference := range references {
+		if m, ok := reference.(map[string]interface{}); ok {
+			keys[i] = fmt.Sprintf("%v\x00%v\x00%v", m["name"], m["type"], m["id"])
+		}
+	}
+
+	sort.Sort(&referencesSorter{references: references, keys: keys})
+}
+
+// referencesSorter permit to sort references with precomputed keys
+type referencesSorter struct {
+	references []interface{}
+	keys       []string
+}
+
+func (s *referencesSorter) Len() int {
+	return len(s.references)
+}
+
+func (s *referencesSorter) Less(i, j int) bool {
+	return s.keys[i] < s.keys[j]
+}
+
+func (s *referencesSorter) Swap(i, j int) {
+	s.references[i], s.references[j] = s.references[j], s.references[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
+// hashSavedObjectsPrefix is the prefix of each saved object hash stored in state instead of data
+const hashSavedObjectsPrefix = "sha256:"
+
+// hashSavedObjects permit to compute the hash of each normalized saved object of NDJSON data
+// Data can also be the hashes previously formated with formatSavedObjectsHash
+func hashSavedObjects(data string, ignoredFields []string) (map[string]string, error) {
+	if hashes, ok := parseSavedObjectsHash(data); ok {
+		return hashes, nil
+	}
+
+	objects, err := normalizeSavedObjects(data, ignoredFields)
+	if err != nil {
+		return nil, err
+	}
+
+	return hashNormalizedSavedObjects(objects)
+}
+
+// hashNormalizedSavedObjects permit to compute the hash of each saved object returned by normalizeSavedObjects
+func hashNormalizedSavedObjects(objects map[string]map[string]interface{}) (map[string]string, error) {
+	hashes := make(map[string]string, len(objects))
+	for key, object := range objects {
+		b, err := json.Marshal(object)
+		if err != nil {
+			return nil, err
+		}
+		hashes[key] = fmt.Sprintf("%s%x", hashSavedObjectsPrefix, sha256.Sum256(b))
+	}
+
+	return hashes, nil
+}
+
+// formatSavedObjectsHash return the readable list of saved objects hash, one object by line
+func formatSavedObjectsHash(hashes map[string]string) string {
+	lines := make([]string, 0, len(hashes))
+	for key, hash := range hashes {
+		lines = append(lines, fmt.Sprintf("%s %s", key, hash))
+	}
+	sort.Strings(lines)
+
+	return strings.Join(lines, "\n")
+}
+
+// stateSavedObjectsHash permit to keep on plan and state the hash of each object instead of the full NDJSON
+// Objects are normalized with the default ignored fields, data is kept as is when it's not valid NDJSON
+func stateSavedObjectsHash(v interface{}) string {
+	hashes, err := hashSavedObjects(v.(string), defaultIgnoredFields)
+	if err != nil {
+		return v.(string)
+	}
+
+	return formatSavedObjectsHash(hashes)
+}
+
+// parseSavedObjectsHash permit to read the saved objects hash formated with formatSavedObjectsHash
+// It return false if data is not a list of hash
+func parseSavedObjectsHash(data string) (map[string]string, bool) {
+	hashes := map[string]string{}
+	if strings.TrimSpace(data) == "" {
+		return hashes, false
+	}
+
+	for _, line := range strings.Split(data, "\n") {
+		i := strings.LastIndex(line, " "+hashSavedObjectsPrefix)
+		if i <= 0 || strings.HasPrefix(line, "{") {
+			return nil, false
+		}
+		hashes[line[:i]] = line[i+1:]
+	}
+
+	return hashes, true
+}
+
+// diffSavedObjects return the readable list of saved objects added, changed or removed between old and new hashes
+// The objects only in old are ignored if they are not managed, like the references exported with objects
+func diffSavedObjects(oldHashes map[string]string, newHashes map[string]string, isManaged func(key string) bool) []string {
+	changes := make([]string, 0)
+
+	for key, newHash := range newHashes {
+		oldHash, ok := oldHashes[key]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("%s: added", key))
+		} else if oldHash != newHash {
+			changes = append(changes, fmt.Sprintf("%s: changed", key))
+		}
+	}
+	for key := range oldHashes {
+		if _, ok := newHashes[key]; !ok && isManaged(key) {
+			changes = append(changes, fmt.Sprintf("%s: removed", key))
+		}
+	}
+	sort.Strings(changes)
+
+	return changes
+}
+
+// savedObjectCopyRetry is the resolution to apply on saved object that failed to copy in space
+type savedObjectCopyRetry struct {
+	Type          string `json:"type"`
+	ID            string `json:"id"`
+	Overwrite     bool   `json:"overwrite"`
+	DestinationID string `json:"destinationId,omitempty"`
+}
+
+// savedObjectCopyParameter is the parameter of copy saved objects API
+// The Kibana client not yet support createNewCopies
+type savedObjectCopyParameter struct {
+	*kbapi.KibanaSpaceCopySavedObjectParameter
+	CreateNewCopies bool `json:"createNewCopies,omitempty"`
+}
+
+// copySavedObjects permit to copy saved objects to spaces and return the result for each space
+// The Kibana client discard the result, so the API is called directly
+func copySavedObjects(client *kibana.Client, parameter *savedObjectCopyParameter, sourceSpace string) (map[string]*savedObjectImportResponse, error) {
+	path := spacePath(sourceSpace, "/api/spaces/_copy_saved_objects")
+	log.Debugf("URL to copy objects: %s", path)
+
+	return postCopySavedObjects(client, path, parameter)
+}
+
+// resolveCopySavedObjectsErrors permit to retry the copy of saved objects with resolve copy errors API
+// It's not yet provided by the Kibana client
+func resolveCopySavedObjectsErrors(client *kibana.Client, objects []kbapi.KibanaSpaceObjectParameter, includeReferences bool, createNewCopies bool, retries map[string][]savedObjectCopyRetry, sourceSpace string) (map[string]*savedObjectImportResponse, error) {
+	path := spacePath(sourceSpace, "/api/spaces/_resolve_copy_saved_objects_errors")
+	log.Debugf("URL to resolve copy errors: %s", path)
+
+	parameter := map[string]interface{}{
+		"objects":           objects,
+		"includeReferences": includeReferences,
+		"retries":           retries,
+	}
+	if createNewCopies {
+		parameter["createNewCopies"] = true
+	}
+
+	return postCopySavedObjects(client, path, parameter)
+}
+
+// postCopySavedObjects permit to call copy saved objects API and read the result of each space
+func postCopySavedObjects(client *kibana.Client, path string, parameter interface{}) (map[string]*savedObjectImportResponse, error) {
+	results := map[string]*savedObjectImportResponse{}
+	if err := postSavedObjectsAPI(client, path, parameter, &results); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// savedObjectSpaces is the spaces of saved object, returned by spaces API
+type savedObjectSpaces struct {
+	Type      string            `json:"type"`
+	ID        string            `json:"id"`
+	Spaces    []string          `json:"spaces"`
+	IsMissing bool              `json:"isMissing,omitempty"`
+	Error     *savedObjectError `json:"error,omitempty"`
+}
+
+// updateObjectsSpaces permit to share saved objects to spaces or remove them from spaces
+// It's not yet provided by the Kibana client
+func updateObjectsSpaces(client *kibana.Client, objects []kbapi.KibanaSpaceObjectParameter, spacesToAdd []string, spacesToRemove []string, space string) ([]savedObjectSpaces, error) {
+	path := spacePath(space, "/api/spaces/_update_objects_spaces")
+	log.Debugf("URL to update objects spaces: %s", path)
+
+	parameter := map[string]interface{}{
+		"objects":        objects,
+		"spacesToAdd":    spacesToAdd,
+		"spacesToRemove": spacesToRemove,
+	}
+	results := &struct {
+		Objects []savedObjectSpaces `json:"objects"`
+	}{}
+	if err := postSavedObjectsAPI(client, path, parameter, results); err != nil {
+		return nil, err
+	}
+
+	return results.Objects, nil
+}
+
+// getShareableReferences return the saved objects and all their references, with their spaces
+// It's not yet provided by the Kibana client
+func getShareableReferences(client *kibana.Client, objects []kbapi.KibanaSpaceObjectParameter, space string) ([]savedObjectSpaces, error) {
+	path := spacePath(space, "/api/spaces/_get_shareable_references")
+	log.Debugf("URL to get shareable references: %s", path)
+
+	parameter := map[string]interface{}{
+		"objects": objects,
+	}
+	results := &struct {
+		Objects []savedObjectSpaces `json:"objects"`
+	}{}
+	if err := postSavedObjectsAPI(client, path, parameter, results); err != nil {
+		return nil, err
+	}
+
+	return results.Objects, nil
+}
+
+// postSavedObjectsAPI permit to call saved objects API not provided by the Kibana client and read the result
+func postSavedObjectsAPI(client *kibana.Client, path string, parameter interface{}, result interface{}) error {
+	jsonData, err := json.Marshal(parameter)
+	if err != nil {
+		return err
+	}
+	log.Debugf("Parameter: %s", jsonData)
+
+	resp, err := client.Client.R().
+		SetBody(jsonData).
+		Post(path)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() >= http.StatusMultipleChoices {
+		return newKibanaError(resp)
+	}
+	log.Debugf("Response: %s", resp.Body())
+
+	if err = json.Unmarshal(resp.Body(), result); err != nil {
+		return errors.Wrapf(err, "Error when parse response of %s", path)
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package kb
+
+import (
+	"testing"
+)
+
+func TestParseSavedObjects(t *testing.T) {
+	objects, err := parseSavedObjects(`{"id":"test","type":"index-pattern","attributes":{"title":"test"}}
+
+{"id":"test","type":"dashboard","attributes":{"title":"test"}}
+{"exportedCount":2,"missingRefCount":0,"missingReferences":[]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 || objects[1]["type"] != "dashboard" {
+		t.Fatalf("Two objects expected, got %+v", objects)
+	}
+
+	if _, err = parseSavedObjects(`{"type":"dashboard","attributes":{"title":"test"}}`); err == nil {
+		t.Fatal("Object without id must failed")
+	}
+	if _, err = parseSavedObjects(`{"id":"test",`); err == nil {
+		t.Fatal("Invalid JSON must failed")
+	}
+}
+
+func TestHashSavedObjects(t *testing.T) {
+	hashes, err := hashSavedObjects(`{"id":"test","type":"index-pattern","attributes":{"title":"test"},"version":"WzEsMV0="}
+{"exportedCount":1,"missingRefCount":0,"missingReferences":[]}`, defaultIgnoredFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherHashes, err := hashSavedObjects(`{"type":"index-pattern","attributes":{"title":"test"},"id":"test"}`, defaultIgnoredFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 1 || hashes["index-pattern/test"] != otherHashes["index-pattern/test"] {
+		t.Fatalf("Same objects must have the same hash, got %+v and %+v", hashes, otherHashes)
+	}
+
+	// Formated hashes can be read back
+	parsedHashes, ok := parseSavedObjectsHash(formatSavedObjectsHash(hashes))
+	if !ok || parsedHashes["index-pattern/test"] != hashes["index-pattern/test"] {
+		t.Fatalf("Formated hashes must be parsed, got %+v", parsedHashes)
+	}
+	if _, ok = parseSavedObjectsHash(`{"id":"test","type":"index-pattern"}`); ok {
+		t.Fatal("NDJSON must not be parsed as hashes")
+	}
+}
@@ -1,6 +1,12 @@
 package kb
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+)
 
 // optionalInterfaceJSON permit to convert string as json object
 func optionalInterfaceJSON(input string) interface{} {
@@ -11,6 +17,20 @@ func optionalInterfaceJSON(input string) interface{} {
 
 }
 
+// optionalMapJSON permit to convert string as json map
+func optionalMapJSON(input string) (map[string]interface{}, error) {
+	if input == "" || input == "{}" {
+		return nil, nil
+	}
+
+	data := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(input), &data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
 // convertArrayInterfaceToArrayString permit to convert an array of interface to an array of string
 func convertArrayInterfaceToArrayString(raws []interface{}) []string {
 	data := make([]string, len(raws))
@@ -21,6 +41,35 @@ func convertArrayInterfaceToArrayString(raws []interface{}) []string {
 	return data
 }
 
+// spacePath permit to prefix API path with the user space, like the Kibana client does
+func spacePath(space string, path string) string {
+	if space == "" || space == "default" {
+		return path
+	}
+	return fmt.Sprintf("/s/%s%s", space, path)
+}
+
+// diagAttributeError return error diagnostic with the path of the attribute that caused it
+func diagAttributeError(attribute string, err error) diag.Diagnostics {
+	return diag.Diagnostics{
+		{
+			Severity:      diag.Error,
+			Summary:       err.Error(),
+			AttributePath: cty.GetAttrPath(attribute),
+		},
+	}
+}
+
+// diagWarning return warning diagnostic, so it's displayed on Terraform UI
+func diagWarning(summary string, params ...interface{}) diag.Diagnostics {
+	return diag.Diagnostics{
+		{
+			Severity: diag.Warning,
+			Summary:  fmt.Sprintf(summary, params...),
+		},
+	}
+}
+
 // unused method
 //func convertMapInterfaceToMapString(raws map[string]interface{}) map[string]string {
 //	data := make(map[string]string)
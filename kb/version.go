@@ -0,0 +1,101 @@
+package kb
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/ggsood/go-kibana-rest/v7/kbapi"
+	"github.com/pkg/errors"
+)
+
+var versionRegexp = regexp.MustCompile(`^v?(\d+)\.(\d+)(?:\.(\d+))?(?:-([0-9A-Za-z.-]+))?$`)
+
+// kibanaVersion is the semantic version of Kibana
+type kibanaVersion struct {
+	Major      int
+	Minor      int
+	Patch      int
+	PreRelease string
+}
+
+// parseKibanaVersion permit to parse semantic version like 7.10.2 or 8.0.0-SNAPSHOT
+func parseKibanaVersion(raw string) (*kibanaVersion, error) {
+	matches := versionRegexp.FindStringSubmatch(raw)
+	if matches == nil {
+		return nil, errors.Errorf("Invalid Kibana version %q", raw)
+	}
+
+	version := &kibanaVersion{
+		PreRelease: matches[4],
+	}
+	version.Major, _ = strconv.Atoi(matches[1])
+	version.Minor, _ = strconv.Atoi(matches[2])
+	if matches[3] != "" {
+		version.Patch, _ = strconv.Atoi(matches[3])
+	}
+
+	return version, nil
+}
+
+// mustParseKibanaVersion is like parseKibanaVersion but panic if version is invalid
+// It's only used to declare static versions
+func mustParseKibanaVersion(raw string) *kibanaVersion {
+	version, err := parseKibanaVersion(raw)
+	if err != nil {
+		panic(err)
+	}
+	return version
+}
+
+// Compare return -1, 0 or 1 if version is lower, equal or greater than other
+// Pre release version is lower than the release version
+func (v *kibanaVersion) Compare(other *kibanaVersion) int {
+	for _, diff := range []int{v.Major - other.Major, v.Minor - other.Minor, v.Patch - other.Patch} {
+		if diff < 0 {
+			return -1
+		} else if diff > 0 {
+			return 1
+		}
+	}
+
+	switch {
+	case v.PreRelease == other.PreRelease:
+		return 0
+	case v.PreRelease == "":
+		return 1
+	case other.PreRelease == "":
+		return -1
+	case v.PreRelease < other.PreRelease:
+		return -1
+	default:
+		return 1
+	}
+}
+
+// LessThan return true if version is strictly lower than other
+func (v *kibanaVersion) LessThan(other *kibanaVersion) bool {
+	return v.Compare(other) < 0
+}
+
+// String return the version as string
+func (v *kibanaVersion) String() string {
+	if v.PreRelease != "" {
+		return fmt.Sprintf("%d.%d.%d-%s", v.Major, v.Minor, v.Patch, v.PreRelease)
+	}
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// getKibanaVersion permit to extract Kibana version from status API response
+func getKibanaVersion(kibanaStatus kbapi.KibanaStatus) (*kibanaVersion, error) {
+	versionStatus, ok := kibanaStatus["version"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("Kibana status doesn't contain version")
+	}
+	number, ok := versionStatus["number"].(string)
+	if !ok {
+		return nil, errors.New("Kibana status doesn't contain version number")
+	}
+
+	return parseKibanaVersion(number)
+}
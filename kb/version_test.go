@@ -0,0 +1,105 @@
+package kb
+
+import (
+	"testing"
+
+	"github.com/ggsood/go-kibana-rest/v7/kbapi"
+)
+
+func TestParseKibanaVersion(t *testing.T) {
+	versions := map[string]string{
+		"7.9.2":          "7.9.2",
+		"7.10.0":         "7.10.0",
+		"v7.10":          "7.10.0",
+		"8.0.0-SNAPSHOT": "8.0.0-SNAPSHOT",
+	}
+	for raw, expected := range versions {
+		version, err := parseKibanaVersion(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version.String() != expected {
+			t.Errorf("Version %s must be parsed as %s, got %s", raw, expected, version)
+		}
+	}
+
+	for _, raw := range []string{"", "7", "seven", "7.x.1"} {
+		if _, err := parseKibanaVersion(raw); err == nil {
+			t.Errorf("Version %q must be invalid", raw)
+		}
+	}
+}
+
+func TestCompareKibanaVersion(t *testing.T) {
+	lowers := [][2]string{
+		{"7.9.0", "7.10.0"},
+		{"7.10.2", "7.11.0"},
+		{"6.8.12", "7.0.0"},
+		{"8.0.0-rc1", "8.0.0"},
+		{"8.0.0-alpha1", "8.0.0-beta1"},
+	}
+	for _, versions := range lowers {
+		lower := mustParseKibanaVersion(versions[0])
+		greater := mustParseKibanaVersion(versions[1])
+		if !lower.LessThan(greater) || greater.LessThan(lower) {
+			t.Errorf("Version %s must be lower than %s", lower, greater)
+		}
+	}
+
+	if mustParseKibanaVersion("7.10.0").Compare(mustParseKibanaVersion("7.10")) != 0 {
+		t.Error("Version 7.10.0 and 7.10 must be equal")
+	}
+}
+
+func TestGetKibanaVersion(t *testing.T) {
+	version, err := getKibanaVersion(kbapi.KibanaStatus{"version": map[string]interface{}{"number": "7.10.2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version.String() != "7.10.2" {
+		t.Errorf("Version must be 7.10.2, got %s", version)
+	}
+
+	if _, err = getKibanaVersion(kbapi.KibanaStatus{"version": "7.10.2"}); err == nil {
+		t.Error("Unexpected status must failed")
+	}
+}
+
+func TestCheckCapabilities(t *testing.T) {
+	capabilities := []kibanaCapability{
+		{MinVersion: mustParseKibanaVersion("7.3.0")},
+		{Attribute: "foo", MinVersion: mustParseKibanaVersion("7.10.0")},
+	}
+	isFooUsed := func(attribute string) bool { return attribute == "foo" }
+	isNothingUsed := func(attribute string) bool { return false }
+
+	if err := checkCapabilities(capabilities, "kibana_test", mustParseKibanaVersion("7.2.0"), isNothingUsed); err == nil {
+		t.Error("Resource must not be supported on Kibana 7.2.0")
+	}
+	if err := checkCapabilities(capabilities, "kibana_test", mustParseKibanaVersion("7.9.0"), isNothingUsed); err != nil {
+		t.Error(err)
+	}
+	if err := checkCapabilities(capabilities, "kibana_test", mustParseKibanaVersion("7.9.0"), isFooUsed); err == nil {
+		t.Error("Attribute foo must not be supported on Kibana 7.9.0")
+	}
+	if err := checkCapabilities(capabilities, "kibana_test", mustParseKibanaVersion("7.10.0"), isFooUsed); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCheckCapabilitiesRemoved(t *testing.T) {
+	capabilities := []kibanaCapability{
+		{RemovedVersion: mustParseKibanaVersion("8.0.0")},
+	}
+	isNothingUsed := func(attribute string) bool { return false }
+
+	if err := checkCapabilities(capabilities, "kibana_test", mustParseKibanaVersion("7.17.0"), isNothingUsed); err != nil {
+		t.Error(err)
+	}
+	if err := checkCapabilities(capabilities, "kibana_test", mustParseKibanaVersion("8.0.0-rc1"), isNothingUsed); err != nil {
+		t.Error(err)
+	}
+	if err := checkCapabilities(capabilities, "kibana_test", mustParseKibanaVersion("8.1.0"), isNothingUsed); err == nil {
+		t.Error("Resource must not be supported on Kibana 8.1.0")
+	}
+}
@@ -20,7 +20,7 @@ package main
 import (
 	"github.com/ggsood/terraform-provider-kibana/v7/kb"
 
-	"github.com/hashicorp/terraform-plugin-sdk/plugin"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/plugin"
 )
 
 func main() {